@@ -4,12 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"net/http"
+	"io"
 	"os"
 	"os/signal"
+	"runtime/debug"
+	"runtime/pprof"
+	"sort"
 	"sync"
-	"sync/atomic"
-	"syscall"
 	"time"
 
 	"log/slog"
@@ -26,21 +27,58 @@ func (rf RunFunc) Run(ctx context.Context) error {
 }
 
 type runner struct {
-	funcs        []RunFunc
-	funcNames    []string
-	withSignals  bool
-	startMu      sync.Mutex
-	started      bool
-	stopTimeout  time.Duration
-	proceedOnNil bool
-}
+	entries       []*entry
+	signals       map[os.Signal]SignalAction
+	sigSource     <-chan os.Signal
+	clock         Clock
+	dumpWriter    io.Writer
+	reloadMu      sync.Mutex
+	startMu       sync.Mutex
+	started       bool
+	stopTimeout   time.Duration
+	proceedOnNil  bool
+	stackDump     bool
+	recoverPanics bool
+	systemd       bool
+	sd            *sdNotifier
+	logger        *slog.Logger
+	hooks         []Hook
 
-type Option func(*runner)
+	upgradeMu      sync.Mutex
+	upgradeTimeout time.Duration
+
+	// parent is the group this one is a subgroup of, and prefix its name in
+	// the parent, see subgroup
+	parent *runner
+	prefix string
+
+	strategy      Strategy
+	backoff       Backoff
+	maxRestarts   int
+	restartWindow time.Duration
+	restarts      []time.Time
+	breaker       *breaker
+	metrics       metrics
 
-func WithSignals(r *runner) {
-	r.withSignals = true
+	// mu guards the runtime state of the entries, phases and stopping
+	mu       sync.Mutex
+	phases   [][]*entry
+	stopping bool
+	base     context.Context
+	exits    chan exit
+	// launchc and removec are how runners are added and removed while running,
+	// see Launch and Remove. halted is closed once Run stops handling them.
+	launchc chan launchRequest
+	removec chan removeRequest
+	halted  chan struct{}
+	// runCtx is the context passed to Run, and reported is set once the
+	// group has been reported as ready through it
+	runCtx   context.Context
+	reported bool
 }
 
+type Option func(*runner)
+
 func WithStopTimeout(d time.Duration) Option {
 	return func(r *runner) {
 		r.stopTimeout = d
@@ -55,9 +93,105 @@ func WithContinueOnNil(r *runner) {
 	r.proceedOnNil = true
 }
 
+// entry is a Runner registered with a runner along with its per-runner
+// configuration.
+type entry struct {
+	run       Runner
+	group     *runner
+	name      string
+	idx       int
+	deps      []string
+	phase     int
+	policy    RestartPolicy
+	waitReady bool
+	// stopTimeout and drainTimeout override the defaults, see
+	// WithRunnerStopTimeout and WithRunnerDrainTimeout
+	stopTimeout  time.Duration
+	drainTimeout time.Duration
+
+	// set each time the entry is started
+	done      chan struct{}
+	ctx       context.Context
+	cancel    context.CancelCauseFunc
+	notifier  *notifier
+	isReady   bool
+	startedAt time.Time
+	running   bool
+	exitErr   error
+	exitedAt  time.Time
+	// finished is set once the entry has returned and won't be restarted
+	finished bool
+	// removed is set once Remove has been called for the entry
+	removed bool
+	// canceled is set once the current run of the entry has been canceled
+	canceled bool
+	attempts int
+	lastErr  error
+	// failures counts consecutive restarts, for backoff
+	failures int
+	// breaker and breakerFailures track crash loops, see WithCircuitBreaker
+	breaker         BreakerState
+	breakerFailures []time.Time
+
+	// readyc is closed once a run of the entry is ready. It's replaced when
+	// the entry is started again after that, but not when a run fails before
+	// being ready, so that whoever waits on it sees the readiness of the run
+	// which replaced it, see start.
+	readyc chan struct{}
+	// restarting is set while the current run of the entry is being stopped
+	// to be restarted with the OneForAll strategy
+	restarting bool
+}
+
+// exit is sent by an entry's goroutine when it returns.
+type exit struct {
+	e   *entry
+	err error
+}
+
+func (e *entry) String() string {
+	if e.name != "" {
+		return e.group.path(e.name)
+	}
+	return e.group.path(fmt.Sprintf("#%d", e.idx))
+}
+
+// RunnerOption configures a single Runner passed to Add or AddNamed.
+type RunnerOption func(*entry)
+
+// DependsOn declares that the runner must not be started before the runners
+// with the given names are ready, and that it will be stopped before any of
+// them are. Dependencies are resolved when Run is called.
+func DependsOn(names ...string) RunnerOption {
+	return func(e *entry) {
+		e.deps = append(e.deps, names...)
+	}
+}
+
+// WithStackDump makes Run capture the stacks of the runners which are still
+// running when the stop timeout elapses, see ShutdownTimeoutError.
+func WithStackDump(r *runner) {
+	r.stackDump = true
+}
+
+// WithRecover makes Run recover from panics in runners. A panic is turned
+// into a *PanicError which is handled like any other error returned by the
+// runner, so the other runners are shut down gracefully.
+func WithRecover(r *runner) {
+	r.recoverPanics = true
+}
+
 func New(opts ...Option) *runner {
 	r := &runner{
-		funcs: make([]RunFunc, 0),
+		entries:       make([]*entry, 0),
+		exits:         make(chan exit),
+		launchc:       make(chan launchRequest),
+		removec:       make(chan removeRequest),
+		halted:        make(chan struct{}),
+		backoff:       Backoff{Min: 100 * time.Millisecond, Max: 10 * time.Second},
+		maxRestarts:   3,
+		restartWindow: 5 * time.Second,
+		clock:         systemClock{},
 	}
 	for _, opt := range opts {
 		opt(r)
@@ -65,24 +199,86 @@ func New(opts ...Option) *runner {
 	return r
 }
 
-func (r *runner) Add(f Runner) {
+func (r *runner) Add(f Runner, opts ...RunnerOption) {
+	r.add(f, "", opts)
+}
+
+func (r *runner) AddNamed(f Runner, name string, opts ...RunnerOption) {
+	r.add(f, name, opts)
+}
+
+func (r *runner) add(f Runner, name string, opts []RunnerOption) {
 	r.startMu.Lock()
+	defer r.startMu.Unlock()
 	if r.started {
 		panic("Add called after Run started")
 	}
-	r.funcs = append(r.funcs, f.Run)
-	r.funcNames = append(r.funcNames, "")
-	r.startMu.Unlock()
+	e := &entry{run: f, group: r, name: name, idx: len(r.entries)}
+	for _, opt := range opts {
+		opt(e)
+	}
+	r.entries = append(r.entries, e)
 }
 
-func (r *runner) AddNamed(f Runner, name string) {
-	r.startMu.Lock()
-	if r.started {
-		panic("Add called after Run started")
+// resolve groups the entries into dependency order. Entries in phase n only
+// depend on entries in phases lower than n.
+func (r *runner) resolve() ([][]*entry, error) {
+	byName := make(map[string][]*entry)
+	for _, e := range r.entries {
+		if e.name != "" {
+			byName[e.name] = append(byName[e.name], e)
+		}
 	}
-	r.funcs = append(r.funcs, f.Run)
-	r.funcNames = append(r.funcNames, name)
-	r.startMu.Unlock()
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[*entry]int)
+	var visit func(e *entry) error
+	visit = func(e *entry) error {
+		switch state[e] {
+		case visiting:
+			return fmt.Errorf("await: dependency cycle involving %q", e)
+		case visited:
+			return nil
+		}
+		state[e] = visiting
+		e.phase = 0
+		for _, name := range e.deps {
+			deps, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("await: %q depends on unknown runner %q", e, name)
+			}
+			for _, dep := range deps {
+				if err := visit(dep); err != nil {
+					return err
+				}
+				e.phase = max(e.phase, dep.phase+1)
+			}
+		}
+		state[e] = visited
+		return nil
+	}
+
+	var phases [][]*entry
+	for _, e := range r.entries {
+		if err := visit(e); err != nil {
+			return nil, err
+		}
+		if err := e.checkRestart(); err != nil {
+			return nil, err
+		}
+		for len(phases) <= e.phase {
+			phases = append(phases, nil)
+		}
+	}
+	for _, e := range r.entries {
+		phases[e.phase] = append(phases[e.phase], e)
+		// so that runners launched later can wait for it, see Launch
+		e.readyc = make(chan struct{})
+	}
+	return phases, nil
 }
 
 // RunAll runs all the given synchronous functions and returns the first
@@ -90,6 +286,17 @@ func (r *runner) AddNamed(f Runner, name string) {
 // catches SIGINT and SIGTERM and begins shutdown by canceling the context.
 // It also cancels the other contexts in case it encounters an error, and waits
 // until they've returned before returning itself.
+//
+// Runners are started in dependency order (see DependsOn): each phase of
+// runners is started only once the phase before it is ready (see Ready). On
+// shutdown the phases are canceled in reverse order, each being given an equal
+// share of what remains of the stop timeout. If some runners still haven't
+// returned once it has elapsed, the returned error wraps a
+// *ShutdownTimeoutError.
+//
+// Any error returned by Run other than a dependency resolution error is an
+// *ExitError recording how each runner returned, including the errors
+// returned by runners while shutting down.
 func (r *runner) Run(ctx context.Context) error {
 	r.startMu.Lock()
 	if r.started {
@@ -102,110 +309,557 @@ func (r *runner) Run(ctx context.Context) error {
 		r.stopTimeout = 10 * time.Second
 	}
 
-	errc := make(chan error, len(r.funcs))
-	// this cancel func cancels all subroutines
-	subctx, cancel := context.WithCancelCause(ctx)
-
-	var waitCount int32
-
-	for i, f := range r.funcs {
-		atomic.AddInt32(&waitCount, 1)
-		go func(fn func(context.Context) error, idx int) {
-			err := fn(subctx)
-			if err != nil && !errors.Is(err, context.Canceled) {
-				if r.funcNames[idx] != "" {
-					slog.Info(fmt.Sprintf("subroutine %s error: %+v", r.funcNames[idx], err))
-				} else {
-					slog.Info(fmt.Sprintf("subroutine error: %+v", err))
-				}
-			}
-			// Order matters for the following two statements.
-			// We must decrement before writing to the channel so that waitCount is
-			// accurate when we read the remaining waitCount below after reading errC.
-			atomic.AddInt32(&waitCount, -1)
-			errc <- err
-		}(f, i)
+	phases, err := r.resolve()
+	if err != nil {
+		return err
 	}
+	r.mu.Lock()
+	r.phases = phases
+	r.runCtx = ctx
+	r.mu.Unlock()
+	// once the loop below is done, exits are no longer received
+	defer close(r.halted)
+	// this cancel func begins shutdown. The subroutines don't run under subctx
+	// directly, each gets its own context so that they can be canceled phase by
+	// phase.
+	subctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	r.base = context.WithoutCancel(ctx)
 
-	var err error
-	var sigc chan os.Signal
+	var sigc <-chan os.Signal
 
-	if r.withSignals {
+	if r.parent != nil {
+		// signals are handled by the root group
+	} else if r.sigSource != nil {
+		sigc = r.sigSource
+	} else if len(r.signals) > 0 {
 		// receive from a nil channel blocks forever. so by wrapping the allocation
 		// in this statement, we're only making the channel non-nil if signals are
 		// enabled. Select below will then only have the option between ctx.Done or
 		// the err channel
-		sigc = make(chan os.Signal, 1)
-		signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+		c := make(chan os.Signal, 1)
+		for sig := range r.signals {
+			signal.Notify(c, sig)
+		}
+		defer signal.Stop(c)
+		sigc = c
 	}
 
+	if r.systemd && r.parent == nil {
+		if r.sd, err = newSDNotifier(); err != nil {
+			r.log().Error("await: connecting to systemd", "err", err)
+		}
+		defer r.sd.close()
+		if interval := watchdogInterval(); interval > 0 && r.sd != nil {
+			stopWatchdog := make(chan struct{})
+			defer close(stopWatchdog)
+			go r.watchdog(interval/2, stopWatchdog)
+		}
+	}
+
+	// the startup goroutine is stopped by canceling startCtx, both on shutdown
+	// and before restarting everything with the OneForAll strategy.
+	startCtx, stopStart := context.WithCancel(subctx)
+	startDone := r.start(startCtx)
+
+	// restartc receives the entries whose restart delay has passed. A nil entry
+	// means all of them should be restarted.
+	restartc := make(chan *entry)
+	scheduleRestart := func(e *entry, delay time.Duration) {
+		r.clock.AfterFunc(delay, func() {
+			select {
+			case restartc <- e:
+			case <-subctx.Done():
+			}
+		})
+	}
+	// restartingAll is set while runners are being stopped to be restarted with
+	// the OneForAll strategy. stopping is the number of them which haven't
+	// returned yet, see entry.restarting, and restartDelay is the delay once
+	// they all have.
+	var restartingAll bool
+	var stopping int
+	var restartDelay time.Duration
+
+	// upgradedc receives once a process started by SignalUpgrade is ready.
+	upgradedc := make(chan struct{})
+
+	// remaining is the number of subroutines which haven't finished for good.
+	remaining := len(r.entries)
+	// trigger is the entry whose exit began the shutdown, if any.
+	var trigger *entry
+	// cause is given to the runners when they're stopped.
+	var cause *ShutdownCause
+
 loop:
-	select {
-	case sig := <-sigc:
-		slog.Error("stopping on signal", "signal", sig)
-	case <-subctx.Done():
-		err = subctx.Err()
-		if !errors.Is(err, context.Canceled) {
-			slog.Error("error on context done", "err", err)
-		}
-	case err = <-errc:
-		if err != nil {
-			slog.Warn("await: stopping on error returned", "err", err)
-		} else {
-			if r.proceedOnNil && atomic.LoadInt32(&waitCount) > 0 {
-				goto loop
-			} else {
-				slog.Debug("await: stopping on subroutine(s) complete")
+	for {
+		select {
+		case sig := <-sigc:
+			r.emit(Event{Type: EventSignal, Signal: sig})
+			switch r.signals[sig] {
+			case SignalReload:
+				r.log().Info("reloading on signal", "signal", sig)
+				go func() {
+					if err := r.Reload(subctx); err != nil {
+						r.log().Error("await: reload failed", "err", err)
+					}
+				}()
+				continue
+			case SignalDump:
+				r.dump()
+				continue
+			case SignalUpgrade:
+				r.log().Info("upgrading on signal", "signal", sig)
+				go func() {
+					if err := r.upgrade(); err != nil {
+						r.log().Error("await: upgrade failed", "err", err)
+						return
+					}
+					select {
+					case upgradedc <- struct{}{}:
+					case <-subctx.Done():
+					}
+				}()
+				continue
+			}
+			r.log().Error("stopping on signal", "signal", sig)
+			cause = &ShutdownCause{Reason: ShutdownSignal, Signal: sig}
+			break loop
+		case <-upgradedc:
+			r.log().Info("stopping after upgrade")
+			cause = &ShutdownCause{Reason: ShutdownUpgrade}
+			break loop
+		case <-subctx.Done():
+			err = subctx.Err()
+			if !errors.Is(err, context.Canceled) {
+				r.log().Error("error on context done", "err", err)
+			}
+			cause = &ShutdownCause{Reason: ShutdownParent, Err: context.Cause(ctx)}
+			if pc := r.parentCause(ctx); pc != nil {
+				cause = pc
+			}
+			break loop
+		case e := <-restartc:
+			if e != nil {
+				if !e.removed {
+					r.launch(e)
+				}
+				continue
+			}
+			restartingAll = false
+			startCtx, stopStart = context.WithCancel(subctx)
+			startDone = r.start(startCtx)
+		case req := <-r.launchc:
+			err := r.addRunning(req.e)
+			if err == nil {
+				remaining++
+				if deps := r.pendingDeps(req.e); len(deps) == 0 {
+					r.launch(req.e)
+				} else {
+					// it's launched through restartc once they're ready
+					go func(e *entry) {
+						for _, c := range deps {
+							select {
+							case <-c:
+							case <-subctx.Done():
+								return
+							}
+						}
+						select {
+						case restartc <- e:
+						case <-subctx.Done():
+						}
+					}(req.e)
+				}
 			}
+			req.reply <- err
+		case req := <-r.removec:
+			e := r.lookup(req.name)
+			if e == nil {
+				req.reply <- nil
+				continue
+			}
+			r.mu.Lock()
+			e.removed = true
+			if e.readyc != nil && !e.readyClosed() {
+				// don't hold up the runners which depend on it
+				close(e.readyc)
+			}
+			running := e.running
+			if running {
+				e.cancel(errRemoved)
+				e.canceled = true
+			}
+			if !running {
+				// it's waiting to be restarted, or its exit is yet to be
+				// received, which must then not count it again
+				e.finished = true
+			}
+			r.mu.Unlock()
+			if !running {
+				r.drop(e)
+				remaining--
+			}
+			req.reply <- e
+		case x := <-r.exits:
+			r.mu.Lock()
+			restarting := x.e.restarting
+			x.e.restarting = false
+			r.mu.Unlock()
+			if x.e.removed {
+				r.mu.Lock()
+				dropped := x.e.finished
+				x.e.finished = true
+				r.mu.Unlock()
+				if !dropped {
+					r.drop(x.e)
+					remaining--
+				}
+				if restarting {
+					if stopping--; stopping == 0 {
+						scheduleRestart(nil, restartDelay)
+					}
+				}
+				continue
+			}
+			if restarting {
+				if stopping--; stopping == 0 {
+					scheduleRestart(nil, restartDelay)
+				}
+				continue
+			}
+
+			now := r.clock.Now()
+			if x.e.shouldRestart(x.err) {
+				var delay time.Duration
+				if r.breaker != nil {
+					var opened bool
+					if delay, opened = r.breakerDelay(x.e, x.err, now); opened {
+						r.emit(Event{Type: EventCircuitOpen, Name: x.e.String(), Err: x.err, Delay: delay})
+						r.log().Warn("await: circuit open, pausing restarts", "name", x.e.String(), "for", delay, "err", x.err)
+					}
+				} else {
+					if !r.allowRestart(now) {
+						err = fmt.Errorf("%w: %s: %w", ErrTooManyRestarts, x.e, x.err)
+						trigger = x.e
+						r.log().Warn("await: stopping on too many restarts", "err", err)
+						cause = &ShutdownCause{Reason: ShutdownPeerFailed, Runner: x.e.String(), Err: err}
+						break loop
+					}
+					delay = r.restartDelay(x.e, now)
+				}
+				r.emit(Event{Type: EventRestarting, Name: x.e.String(), Err: x.err, Delay: delay})
+				r.log().Info("await: restarting subroutine", "name", x.e.String(), "in", delay, "err", x.err)
+				if r.strategy != OneForAll {
+					scheduleRestart(x.e, delay)
+					continue
+				}
+				if restartingAll {
+					// it returned on its own while the others are being
+					// stopped, and will be started again along with them
+					continue
+				}
+				restartingAll = true
+				restartDelay = delay
+				stopStart()
+				<-startDone
+				if stopping = r.cancelRunning(errRestarting); stopping == 0 {
+					scheduleRestart(nil, restartDelay)
+				}
+				continue
+			}
+
+			r.mu.Lock()
+			x.e.finished = true
+			r.mu.Unlock()
+			remaining--
+			err = x.err
+			trigger = x.e
+			if err != nil {
+				r.log().Warn("await: stopping on error returned", "err", err)
+				cause = &ShutdownCause{Reason: ShutdownPeerFailed, Runner: x.e.String(), Err: err}
+				break loop
+			}
+			if r.proceedOnNil && remaining > 0 {
+				continue
+			}
+			r.log().Debug("await: stopping on subroutine(s) complete")
+			cause = &ShutdownCause{Reason: ShutdownPeerDone, Runner: x.e.String()}
+			break loop
 		}
 	}
 
-	cancel(fmt.Errorf("await: %w", err))
+	r.mu.Lock()
+	r.stopping = true
+	r.mu.Unlock()
+	shutdownStart := r.clock.Now()
+	r.emit(Event{Type: EventShutdown, Err: err})
+	r.sdNotify("STOPPING=1")
+
+	cancel(cause)
+	stopStart()
+	// wait for startup to notice so that no more subroutines get started
+	<-startDone
+
+	// signals are still handled while shutting down, so that a second stop
+	// signal can cut the wait short
+	forced := make(chan struct{})
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		for {
+			select {
+			case sig := <-sigc:
+				r.emit(Event{Type: EventSignal, Signal: sig})
+				switch r.signals[sig] {
+				case SignalStop:
+					r.log().Error("forcing shutdown on signal", "signal", sig)
+					close(forced)
+					return
+				case SignalDump:
+					r.dump()
+				}
+			case <-stopped:
+				return
+			}
+		}
+	}()
+
+	r.mu.Lock()
+	phases = r.phases
+	r.mu.Unlock()
+	deadline := r.clock.Now().Add(r.stopTimeout)
+	for p := len(phases) - 1; p >= 0; p-- {
+		timeout := deadline.Sub(r.clock.Now()) / time.Duration(p+1)
+		var stopped []<-chan struct{}
+		r.mu.Lock()
+		for _, e := range phases[p] {
+			if e.running {
+				stopped = append(stopped, r.stop(e, cause, timeout))
+			}
+		}
+		r.mu.Unlock()
+		waitOrAbort(stopped, forced)
+	}
 
-	err = waitOrTimeout(r.stopTimeout, &waitCount, err)
 	if errors.Is(err, context.Canceled) {
+		err = nil
+	}
+	failed := err != nil
+	if hung := r.hung(); len(hung) > 0 {
+		terr := &ShutdownTimeoutError{Running: hung, Err: err}
+		select {
+		case <-forced:
+			terr.Forced = true
+		default:
+		}
+		if r.stackDump {
+			terr.Stacks = stacks(hung)
+		}
+		r.emit(Event{Type: EventShutdownTimeout, Err: terr})
+		r.log().Error("await: shutdown timeout", "running", hung)
+		err = terr
+		failed = true
+	}
+	r.metrics.observeShutdown(r.clock.Now().Sub(shutdownStart))
+	exits := r.exitLog(trigger)
+	for _, x := range exits {
+		failed = failed || isFailure(x.Err)
+	}
+	if !failed {
 		return nil
 	}
-
-	return err
+	return &ExitError{Err: err, Exits: exits}
 }
 
-// waitTimeout will return either when the context is canceled or when the
-// counter reaches 0. It will check the counter every 10ms.
-func waitOrTimeout(timeout time.Duration, counter *int32, err error) error {
-	// slog.Info(fmt.Sprintf("await: waiting %s for subroutines to finish", timeout))
-	for i := 0 * time.Second; i < timeout; i += 100 * time.Millisecond {
-		if atomic.LoadInt32(counter) == 0 {
-			return err
+// start starts the phases one after the other in a new goroutine, skipping
+// entries which have finished or are already running. Once all phases are
+// ready, the runner itself is marked as ready in case it's nested in another,
+// and systemd and the parent process, after an upgrade, are notified.
+// The returned channel is closed once that's done or ctx is canceled.
+func (r *runner) start(ctx context.Context) <-chan struct{} {
+	r.mu.Lock()
+	phases := make([][]*entry, len(r.phases))
+	for p := range r.phases {
+		phases[p] = append([]*entry(nil), r.phases[p]...)
+	}
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, phase := range phases {
+			var ready []<-chan struct{}
+			for _, e := range phase {
+				if ctx.Err() != nil {
+					return
+				}
+				r.mu.Lock()
+				skip := e.finished || e.running || e.removed
+				r.mu.Unlock()
+				if !skip {
+					ready = append(ready, r.launch(e))
+				}
+			}
+			for _, c := range ready {
+				select {
+				case <-c:
+				case <-ctx.Done():
+					return
+				}
+			}
 		}
-		time.Sleep(100 * time.Millisecond)
+		r.mu.Lock()
+		r.reported = true
+		r.mu.Unlock()
+		Ready(ctx)
+		r.sdNotify("READY=1")
+		if r.parent == nil {
+			upgraded()
+		}
+	}()
+	return done
+}
+
+// launch starts a new goroutine running the entry and returns the channel
+// which is closed once it's ready, possibly after being restarted.
+func (r *runner) launch(e *entry) <-chan struct{} {
+	n := &notifier{r: r, e: e, ready: make(chan struct{})}
+	done := make(chan struct{})
+	r.mu.Lock()
+	if e.removed {
+		r.mu.Unlock()
+		close(n.ready)
+		return n.ready
 	}
-	if err != nil {
-		return fmt.Errorf("await: shutdown timeout: %w", err)
+	if e.readyc == nil || e.readyClosed() {
+		e.readyc = make(chan struct{})
+	}
+	readyc := e.readyc
+	e.ctx, e.cancel = context.WithCancelCause(r.base)
+	e.ctx = context.WithValue(e.ctx, readyKey{}, n)
+	e.ctx = context.WithValue(e.ctx, loggerKey{}, r.log().With("runner", e.String()))
+	e.ctx = context.WithValue(e.ctx, clockKey{}, r.clock)
+	r.subgroup(e)
+	e.notifier = n
+	e.isReady = false
+	e.startedAt = r.clock.Now()
+	e.running = true
+	e.canceled = false
+	e.attempts++
+	e.ctx = r.withIdentity(e.ctx, e)
+	if e.breaker == BreakerOpen {
+		e.breaker = BreakerHalfOpen
 	}
-	return nil
+	e.done = done
+	ctx := e.ctx
+	r.mu.Unlock()
+
+	go pprof.Do(ctx, pprof.Labels(labelKey, e.String()), func(ctx context.Context) {
+		r.emit(Event{Type: EventStarted, Name: e.String()})
+		if !e.waitReady {
+			n.set(true)
+		}
+		err := r.call(ctx, e)
+		if isFailure(err) {
+			if e.name != "" {
+				r.log().Info(fmt.Sprintf("subroutine %s error: %+v", e.name, err))
+			} else {
+				r.log().Info(fmt.Sprintf("subroutine error: %+v", err))
+			}
+		}
+		r.mu.Lock()
+		e.running = false
+		e.exitErr = err
+		e.exitedAt = r.clock.Now()
+		if isFailure(err) {
+			e.lastErr = err
+		}
+		close(done)
+		r.mu.Unlock()
+		r.emit(Event{Type: EventExited, Name: e.String(), Err: err})
+		select {
+		case r.exits <- exit{e: e, err: err}:
+		case <-r.halted:
+		}
+	})
+	return readyc
 }
 
-// ListenAndServe provides a graceful shutdown for an http.Server.
-// usage: `w.Add(await.ListenAndServe(srv))` followed by the normal w.Run(ctx)
-func ListenAndServe(server *http.Server) Runner {
-	return RunFunc(func(ctx context.Context) error {
-		errc := make(chan error, 1)
-		go func() {
-			errc <- server.ListenAndServe()
+// call runs the entry, recovering from panics if WithRecover was given.
+func (r *runner) call(ctx context.Context, e *entry) (err error) {
+	if r.recoverPanics {
+		defer func() {
+			if v := recover(); v != nil {
+				err = &PanicError{Name: e.String(), Value: v, Stack: debug.Stack()}
+			}
 		}()
+	}
+	return e.run.Run(ctx)
+}
 
-		select {
-		case <-ctx.Done():
-			cto, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			defer cancel()
-			err := server.Shutdown(cto)
-			if err != nil {
-				return err
-			}
-			return ctx.Err()
-		case err := <-errc:
-			return err
+// cancelRunning cancels the running entries which are to be restarted with
+// the OneForAll strategy with the given cause, marks them as restarting and
+// returns how many there were.
+func (r *runner) cancelRunning(cause error) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, e := range r.entries {
+		if e.running && e.policy != Temporary && e.restartable() {
+			e.cancel(cause)
+			e.canceled = true
+			e.restarting = true
+			n++
 		}
+	}
+	return n
+}
+
+// exitLog returns the last exit of each entry which has returned, in the
+// order they returned.
+func (r *runner) exitLog(trigger *entry) []Exit {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var exits []Exit
+	for _, e := range r.entries {
+		if e.running || e.exitedAt.IsZero() {
+			continue
+		}
+		exits = append(exits, Exit{
+			Name:    e.String(),
+			Err:     e.exitErr,
+			Time:    e.exitedAt,
+			Trigger: e == trigger,
+		})
+	}
+	sort.SliceStable(exits, func(i, j int) bool {
+		return exits[i].Time.Before(exits[j].Time)
 	})
+	return exits
+}
+
+// hung returns the names of the entries which are still running.
+func (r *runner) hung() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var names []string
+	for _, e := range r.entries {
+		if e.running {
+			names = append(names, e.String())
+		}
+	}
+	return names
+}
+
+// waitOrAbort returns once all of the done channels are closed or abort is
+// closed, whichever happens first.
+func waitOrAbort(done []<-chan struct{}, abort <-chan struct{}) {
+	for _, c := range done {
+		select {
+		case <-c:
+		case <-abort:
+			return
+		}
+	}
 }
@@ -0,0 +1,1271 @@
+package await_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/runreveal/lib/await"
+	"github.com/runreveal/lib/await/awaittest"
+)
+
+// recorder records the order in which runners start and stop.
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) record(event string) {
+	r.mu.Lock()
+	r.events = append(r.events, event)
+	r.mu.Unlock()
+}
+
+func (r *recorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+func (r *recorder) runner(name string) await.Runner {
+	return await.RunFunc(func(ctx context.Context) error {
+		r.record("start " + name)
+		await.Ready(ctx)
+		<-ctx.Done()
+		r.record("stop " + name)
+		return ctx.Err()
+	})
+}
+
+// waiting is a runner which is ready right away and runs until canceled.
+func waiting(ctx context.Context) error {
+	await.Ready(ctx)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func equal(t *testing.T, expected, actual []string) {
+	t.Helper()
+	if len(expected) != len(actual) {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	for i := range expected {
+		if expected[i] != actual[i] {
+			t.Fatalf("expected %v, got %v", expected, actual)
+		}
+	}
+}
+
+func TestRunDependencyOrder(t *testing.T) {
+	var rec recorder
+	w := await.New(await.WithStopTimeout(time.Second))
+	w.AddNamed(rec.runner("http"), "http", await.DependsOn("db", "kafka"), await.WithReadiness())
+	w.AddNamed(rec.runner("kafka"), "kafka", await.DependsOn("db"), await.WithReadiness())
+	w.AddNamed(rec.runner("db"), "db", await.WithReadiness())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+
+	deadline := time.Now().Add(time.Second)
+	for len(rec.get()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	equal(t, []string{
+		"start db", "start kafka", "start http",
+		"stop http", "stop kafka", "stop db",
+	}, rec.get())
+}
+
+func TestRunDependencyErrors(t *testing.T) {
+	noop := await.RunFunc(func(ctx context.Context) error { return nil })
+
+	w := await.New()
+	w.AddNamed(noop, "a", await.DependsOn("missing"))
+	if err := w.Run(context.Background()); err == nil {
+		t.Fatal("expected error for unknown dependency")
+	}
+
+	w = await.New()
+	w.AddNamed(noop, "a", await.DependsOn("b"))
+	w.AddNamed(noop, "b", await.DependsOn("a"))
+	if err := w.Run(context.Background()); err == nil {
+		t.Fatal("expected error for dependency cycle")
+	}
+}
+
+func TestRunStopsOnError(t *testing.T) {
+	boom := errors.New("boom")
+	var rec recorder
+	w := await.New(await.WithStopTimeout(time.Second))
+	w.AddNamed(rec.runner("db"), "db")
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		return boom
+	}), "failing", await.DependsOn("db"))
+
+	if err := w.Run(context.Background()); !errors.Is(err, boom) {
+		t.Fatalf("expected %v, got %v", boom, err)
+	}
+	equal(t, []string{"start db", "stop db"}, rec.get())
+}
+
+func TestRunRestartTransient(t *testing.T) {
+	boom := errors.New("boom")
+	var attempts int32
+	w := await.New(
+		await.WithStopTimeout(time.Second),
+		await.WithBackoff(time.Millisecond, 10*time.Millisecond),
+	)
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			return boom
+		}
+		return nil
+	}), "flaky", await.WithRestart(await.Transient))
+
+	if err := w.Run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 3 {
+		t.Fatalf("expected 3 attempts, got %d", n)
+	}
+}
+
+func TestRunRestartBeforeReady(t *testing.T) {
+	boom := errors.New("boom")
+	rec := &awaittest.Recorder{}
+	w := await.New(
+		await.WithStopTimeout(time.Second),
+		await.WithBackoff(time.Millisecond, time.Millisecond),
+		rec.Option(),
+	)
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		if await.Attempt(ctx) == 1 {
+			return boom
+		}
+		await.Ready(ctx)
+		<-ctx.Done()
+		return ctx.Err()
+	}), "db", await.WithReadiness(), await.WithRestart(await.Transient))
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}), "app", await.DependsOn("db"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+
+	// the dependents are started once the restarted runner is ready
+	rec.Wait(t, await.EventStarted, "app")
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestRunRestartIntensity(t *testing.T) {
+	boom := errors.New("boom")
+	var attempts int32
+	w := await.New(
+		await.WithStopTimeout(time.Second),
+		await.WithBackoff(time.Millisecond, time.Millisecond),
+		await.WithRestartIntensity(2, time.Minute),
+	)
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		atomic.AddInt32(&attempts, 1)
+		return boom
+	}), "failing", await.WithRestart(await.Permanent))
+
+	err := w.Run(context.Background())
+	if !errors.Is(err, await.ErrTooManyRestarts) || !errors.Is(err, boom) {
+		t.Fatalf("expected too many restarts, got %v", err)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 3 {
+		t.Fatalf("expected 3 attempts, got %d", n)
+	}
+}
+
+func TestRunOneForAll(t *testing.T) {
+	boom := errors.New("boom")
+	var rec recorder
+	var attempts int32
+	w := await.New(
+		await.WithStopTimeout(time.Second),
+		await.WithStrategy(await.OneForAll),
+		await.WithBackoff(time.Millisecond, time.Millisecond),
+	)
+	w.AddNamed(rec.runner("db"), "db", await.WithRestart(await.Permanent))
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			return boom
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}), "consumer", await.WithRestart(await.Transient))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+
+	deadline := time.Now().Add(time.Second)
+	for len(rec.get()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	equal(t, []string{"start db", "stop db", "start db", "stop db"}, rec.get())
+}
+
+func TestRunOneForAllTemporary(t *testing.T) {
+	rec := &awaittest.Recorder{}
+	w := await.New(
+		await.WithStopTimeout(time.Second),
+		await.WithStrategy(await.OneForAll),
+		await.WithBackoff(time.Millisecond, time.Millisecond),
+		rec.Option(),
+	)
+	w.AddNamed(await.RunFunc(waiting), "temporary")
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		if await.Attempt(ctx) == 1 {
+			return errors.New("boom")
+		}
+		return waiting(ctx)
+	}), "flaky", await.WithRestart(await.Transient))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+	rec.WaitN(t, 2, await.EventStarted, "flaky")
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the temporary runner is left running rather than restarted
+	started := rec.Names(await.EventStarted)
+	slices.Sort(started)
+	equal(t, []string{"flaky", "flaky", "temporary"}, started)
+}
+
+func TestRunOneForAllConcurrentExits(t *testing.T) {
+	releaseB := make(chan struct{})
+	exitedB := make(chan struct{})
+	var once sync.Once
+	rec := &awaittest.Recorder{}
+	w := await.New(
+		await.WithStopTimeout(time.Second),
+		await.WithStrategy(await.OneForAll),
+		await.WithBackoff(time.Millisecond, time.Millisecond),
+		await.WithRestartIntensity(10, time.Second),
+		rec.Option(),
+		await.WithHook(await.HookFunc(func(ev await.Event) {
+			// b returns on its own after a, before either exit is handled,
+			// so that neither is stopped for the restart
+			if ev.Type != await.EventExited {
+				return
+			}
+			switch ev.Name {
+			case "a":
+				once.Do(func() {
+					close(releaseB)
+					<-exitedB
+				})
+			case "b":
+				select {
+				case <-exitedB:
+				default:
+					close(exitedB)
+				}
+			}
+		})),
+	)
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		if await.Attempt(ctx) == 1 {
+			return nil
+		}
+		return waiting(ctx)
+	}), "a", await.WithRestart(await.Permanent))
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		if await.Attempt(ctx) == 1 {
+			<-releaseB
+			return nil
+		}
+		return waiting(ctx)
+	}), "b", await.WithRestart(await.Permanent))
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		await.Ready(ctx)
+		<-ctx.Done()
+		// still stopping while the exits of a and b are handled
+		time.Sleep(20 * time.Millisecond)
+		return ctx.Err()
+	}), "slow", await.WithRestart(await.Transient))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+	rec.WaitN(t, 2, await.EventStarted, "slow")
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	w := await.New(await.WithStopTimeout(time.Second))
+	proceed := make(chan struct{})
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		<-proceed
+		await.Ready(ctx)
+		<-ctx.Done()
+		return ctx.Err()
+	}), "db", await.WithReadiness())
+	h := w.Handler()
+
+	probe := func(path string) int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+	waitFor := func(path string, code int) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for probe(path) != code {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %s to return %d", path, code)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	if code := probe("/healthz"); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected healthz to fail before Run, got %d", code)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+
+	waitFor("/healthz", http.StatusOK)
+	if code := probe("/readyz"); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected readyz to fail before Ready, got %d", code)
+	}
+	close(proceed)
+	waitFor("/readyz", http.StatusOK)
+
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if code := probe("/readyz"); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected readyz to fail after shutdown, got %d", code)
+	}
+}
+
+func TestRunShutdownTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	w := await.New(await.WithStopTimeout(50*time.Millisecond), await.WithStackDump)
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}), "polite")
+	started := make(chan struct{})
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}), "stuck")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	err := w.Run(ctx)
+
+	var terr *await.ShutdownTimeoutError
+	if !errors.As(err, &terr) {
+		t.Fatalf("expected shutdown timeout, got %v", err)
+	}
+	equal(t, []string{"stuck"}, terr.Running)
+	if !strings.Contains(string(terr.Stacks), "TestRunShutdownTimeout") {
+		t.Fatalf("expected stacks of the stuck runner, got:\n%s", terr.Stacks)
+	}
+}
+
+func TestRunRecover(t *testing.T) {
+	var rec recorder
+	w := await.New(await.WithStopTimeout(time.Second), await.WithRecover)
+	w.AddNamed(rec.runner("db"), "db", await.WithReadiness())
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		panic("oops")
+	}), "panicky", await.DependsOn("db"))
+
+	err := w.Run(context.Background())
+	var perr *await.PanicError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected panic error, got %v", err)
+	}
+	if perr.Name != "panicky" || perr.Value != "oops" || len(perr.Stack) == 0 {
+		t.Fatalf("unexpected panic error: %+v", perr)
+	}
+	equal(t, []string{"start db", "stop db"}, rec.get())
+}
+
+func TestRunExitError(t *testing.T) {
+	boom := errors.New("boom")
+	flush := errors.New("flush failed")
+	w := await.New(await.WithStopTimeout(time.Second))
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		await.Ready(ctx)
+		<-ctx.Done()
+		return flush
+	}), "db", await.WithReadiness())
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		return boom
+	}), "failing", await.DependsOn("db"))
+
+	err := w.Run(context.Background())
+	var eerr *await.ExitError
+	if !errors.As(err, &eerr) {
+		t.Fatalf("expected exit error, got %v", err)
+	}
+	if !errors.Is(err, boom) || !errors.Is(err, flush) {
+		t.Fatalf("expected both errors, got %v", err)
+	}
+	if len(eerr.Exits) != 2 {
+		t.Fatalf("expected 2 exits, got %+v", eerr.Exits)
+	}
+	if x := eerr.Exits[0]; x.Name != "failing" || !x.Trigger || x.Err != boom {
+		t.Fatalf("unexpected first exit: %+v", x)
+	}
+	if x := eerr.Exits[1]; x.Name != "db" || x.Trigger || x.Err != flush {
+		t.Fatalf("unexpected second exit: %+v", x)
+	}
+}
+
+func TestRunHooks(t *testing.T) {
+	var rec recorder
+	w := await.New(
+		await.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		await.WithHook(await.HookFunc(func(ev await.Event) {
+			rec.record(ev.Type.String() + " " + ev.Name)
+		})),
+	)
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		return nil
+	}), "job")
+
+	if err := w.Run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	equal(t, []string{"started job", "ready job", "exited job", "shutdown "}, rec.get())
+}
+
+type reloader struct {
+	reloaded chan struct{}
+}
+
+func (r *reloader) Run(ctx context.Context) error {
+	await.Ready(ctx)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (r *reloader) Reload(ctx context.Context) error {
+	close(r.reloaded)
+	return nil
+}
+
+// lockedBuffer is a bytes.Buffer which is safe for concurrent use.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestRunSignals(t *testing.T) {
+	var dump lockedBuffer
+	shutdown := make(chan struct{})
+	w := await.New(
+		await.WithSignals,
+		await.WithSignal(syscall.SIGHUP, await.SignalReload),
+		await.WithSignal(syscall.SIGUSR1, await.SignalDump),
+		await.WithStopTimeout(time.Minute),
+		await.WithHook(await.HookFunc(func(ev await.Event) {
+			if ev.Type == await.EventShutdown {
+				close(shutdown)
+			}
+		})),
+		await.WithDumpWriter(&dump),
+	)
+	rl := &reloader{reloaded: make(chan struct{})}
+	w.AddNamed(rl, "reloader", await.WithReadiness())
+	release := make(chan struct{})
+	defer close(release)
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		await.Ready(ctx)
+		<-release
+		return nil
+	}), "stuck", await.WithReadiness(), await.DependsOn("reloader"))
+
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(context.Background()) }()
+
+	kill := func(sig syscall.Signal) {
+		if err := syscall.Kill(os.Getpid(), sig); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// readiness of the last phase is only observable through the handler
+	deadline := time.Now().Add(time.Second)
+	for {
+		rec := httptest.NewRecorder()
+		w.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if rec.Code == http.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("runners never became ready")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	kill(syscall.SIGHUP)
+	<-rl.reloaded
+
+	kill(syscall.SIGUSR1)
+	deadline = time.Now().Add(time.Second)
+	for !strings.Contains(dump.String(), "goroutine profile") {
+		if time.Now().After(deadline) {
+			t.Fatal("expected a dump")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if !strings.Contains(dump.String(), "reloader\tstate=ready") {
+		t.Fatalf("expected runner states in dump, got:\n%s", dump.String())
+	}
+
+	kill(syscall.SIGINT)
+	<-shutdown
+	kill(syscall.SIGINT)
+
+	var terr *await.ShutdownTimeoutError
+	if err := <-errc; !errors.As(err, &terr) || !terr.Forced {
+		t.Fatalf("expected forced shutdown, got %v", err)
+	}
+	if !slices.Contains(terr.Running, "stuck") {
+		t.Fatalf("expected stuck to be running, got %v", terr.Running)
+	}
+}
+
+func TestRunDynamic(t *testing.T) {
+	var rec recorder
+	w := await.New(await.WithStopTimeout(time.Second))
+	w.AddNamed(rec.runner("db"), "db", await.WithReadiness())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+
+	started := make(chan struct{})
+	tenant := await.RunFunc(func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err := w.Launch(tenant, "tenant-1", await.DependsOn("db")); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := w.Launch(tenant, "tenant-1"); err == nil {
+		t.Fatal("expected error for duplicate name")
+	}
+	if err := w.Remove(context.Background(), "tenant-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	boom := errors.New("boom")
+	if err := w.Launch(await.RunFunc(func(ctx context.Context) error {
+		return boom
+	}), "tenant-2"); err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+	err := <-errc
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected %v, got %v", boom, err)
+	}
+	if err := w.Launch(tenant, "tenant-3"); !errors.Is(err, await.ErrNotRunning) {
+		t.Fatalf("expected %v, got %v", await.ErrNotRunning, err)
+	}
+	equal(t, []string{"start db", "stop db"}, rec.get())
+}
+
+func TestRunLaunchDependsOn(t *testing.T) {
+	proceed := make(chan struct{})
+	rec := &awaittest.Recorder{}
+	w := await.New(await.WithStopTimeout(time.Second), rec.Option())
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		<-proceed
+		return waiting(ctx)
+	}), "db", await.WithReadiness())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+	rec.Wait(t, await.EventStarted, "db")
+
+	// the tenant isn't started until db is ready
+	if err := w.Launch(await.RunFunc(waiting), "tenant", await.DependsOn("db")); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range w.Status() {
+		if s.Name == "tenant" && s.State != await.StatePending {
+			t.Fatalf("expected tenant to be pending, got %s", s.State)
+		}
+	}
+	close(proceed)
+	rec.Wait(t, await.EventStarted, "tenant")
+	equal(t, []string{"db", "tenant"}, rec.Names(await.EventReady))
+
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestRunRemoveExiting(t *testing.T) {
+	var removeB func()
+	w := await.New(
+		await.WithStopTimeout(time.Second),
+		await.WithContinueOnNil,
+		await.WithHook(await.HookFunc(func(ev await.Event) {
+			// b is removed after it has returned, before its exit is handled
+			if ev.Type == await.EventExited && ev.Name == "b" {
+				removeB()
+			}
+		})),
+	)
+	removeB = func() {
+		if err := w.Remove(context.Background(), "b"); err != nil {
+			t.Error(err)
+		}
+	}
+	removed := make(chan struct{})
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		<-removed
+		return nil
+	}), "a")
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		return nil
+	}), "b")
+	causes := make(chan *await.ShutdownCause, 1)
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		await.Ready(ctx)
+		<-ctx.Done()
+		causes <- await.ShutdownCauseFrom(ctx)
+		return ctx.Err()
+	}), "c", await.WithReadiness())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+
+	waitFor := func(cond func([]await.RunnerStatus) bool) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for !cond(w.Status()) {
+			if time.Now().After(deadline) {
+				t.Fatalf("unexpected status %v", w.Status())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitFor(func(s []await.RunnerStatus) bool { return len(s) == 2 })
+	close(removed)
+	waitFor(func(s []await.RunnerStatus) bool { return s[0].State == await.StateExited })
+
+	// c is still running once a and b are done, so it's removed rather than
+	// stopped by a shutdown
+	if err := w.Remove(context.Background(), "c"); err != nil {
+		t.Fatal(err)
+	}
+	if cause := <-causes; cause != nil {
+		t.Fatalf("expected c to be removed, got shut down by %v", cause)
+	}
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	boom := errors.New("boom")
+	proceed := make(chan struct{})
+	w := await.New(
+		await.WithStopTimeout(time.Second),
+		await.WithBackoff(time.Hour, time.Hour),
+	)
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		<-proceed
+		await.Ready(ctx)
+		<-ctx.Done()
+		return ctx.Err()
+	}), "db", await.WithReadiness())
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		return boom
+	}), "flaky", await.WithRestart(await.Transient))
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}), "http", await.DependsOn("db"))
+
+	states := func() map[string]string {
+		rec := httptest.NewRecorder()
+		w.StatusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		var statuses []struct {
+			Name      string `json:"name"`
+			State     string `json:"state"`
+			LastError string `json:"last_error"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &statuses); err != nil {
+			t.Fatal(err)
+		}
+		m := make(map[string]string)
+		for _, s := range statuses {
+			m[s.Name] = s.State
+			if s.LastError != "" {
+				m[s.Name] += ": " + s.LastError
+			}
+		}
+		return m
+	}
+	waitFor := func(expected map[string]string) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for {
+			actual := states()
+			if fmt.Sprint(actual) == fmt.Sprint(expected) {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %v, got %v", expected, actual)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+
+	waitFor(map[string]string{"db": "starting", "flaky": "restarting: boom", "http": "pending"})
+	close(proceed)
+	waitFor(map[string]string{"db": "ready", "flaky": "restarting: boom", "http": "running"})
+
+	cancel()
+	if err := <-errc; !errors.Is(err, boom) {
+		t.Fatalf("expected %v, got %v", boom, err)
+	}
+	waitFor(map[string]string{"db": "exited", "flaky": "exited: boom", "http": "exited"})
+}
+
+func TestShutdownCause(t *testing.T) {
+	boom := errors.New("boom")
+	causes := make(chan *await.ShutdownCause, 1)
+	observer := await.RunFunc(func(ctx context.Context) error {
+		await.Ready(ctx)
+		<-ctx.Done()
+		causes <- await.ShutdownCauseFrom(ctx)
+		return ctx.Err()
+	})
+
+	// a peer failing
+	w := await.New(await.WithStopTimeout(time.Second))
+	w.AddNamed(observer, "observer", await.WithReadiness())
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		return boom
+	}), "failing", await.DependsOn("observer"))
+	if err := w.Run(context.Background()); !errors.Is(err, boom) {
+		t.Fatalf("expected %v, got %v", boom, err)
+	}
+	cause := <-causes
+	if cause == nil || cause.Reason != await.ShutdownPeerFailed || cause.Runner != "failing" || !errors.Is(cause, boom) {
+		t.Fatalf("expected failing to cause the shutdown, got %v", cause)
+	}
+
+	// a signal
+	sigc := make(chan os.Signal)
+	ready := make(chan struct{})
+	w = await.New(
+		await.WithStopTimeout(time.Second),
+		await.WithSignals,
+		await.WithSignalChannel(sigc),
+		await.WithHook(await.HookFunc(func(ev await.Event) {
+			if ev.Type == await.EventReady {
+				close(ready)
+			}
+		})),
+	)
+	w.AddNamed(observer, "observer", await.WithReadiness())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(context.Background()) }()
+	<-ready
+	sigc <- syscall.SIGTERM
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cause := <-causes; cause == nil || cause.Reason != await.ShutdownSignal || cause.Signal != syscall.SIGTERM {
+		t.Fatalf("expected SIGTERM to cause the shutdown, got %v", cause)
+	}
+
+	// the parent context
+	w = await.New(await.WithStopTimeout(time.Second))
+	w.AddNamed(observer, "observer")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := w.Run(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case cause := <-causes:
+		if cause == nil || cause.Reason != await.ShutdownParent || !errors.Is(cause, context.Canceled) {
+			t.Fatalf("expected the parent to cause the shutdown, got %v", cause)
+		}
+	default:
+		// the runner may not have been started
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	boom := errors.New("boom")
+	clock := awaittest.NewClock(time.Unix(0, 0))
+	var rec awaittest.Recorder
+	w := await.New(
+		await.WithClock(clock),
+		await.WithBackoff(time.Second, time.Second),
+		await.WithCircuitBreaker(2, time.Minute, time.Hour),
+		rec.Option(),
+	)
+	var healthy atomic.Bool
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		if !healthy.Load() {
+			return boom
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}), "consumer", await.WithRestart(await.Transient))
+
+	breaker := func() string {
+		return w.Status()[0].Breaker.String()
+	}
+	healthz := func() int {
+		rec := httptest.NewRecorder()
+		w.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		return rec.Code
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+
+	// the first failure is restarted after the backoff, the second one opens
+	// the breaker
+	rec.Wait(t, await.EventRestarting, "consumer")
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	if ev := rec.Wait(t, await.EventCircuitOpen, "consumer"); ev.Delay != time.Hour {
+		t.Fatalf("expected restarts to be paused for an hour, got %v", ev.Delay)
+	}
+	if b := breaker(); b != "open" {
+		t.Fatalf("expected the breaker to be open, got %s", b)
+	}
+	if code := healthz(); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected healthz to fail, got %d", code)
+	}
+
+	// the trial run succeeds
+	healthy.Store(true)
+	clock.BlockUntil(1)
+	clock.Advance(time.Hour)
+	rec.WaitN(t, 3, await.EventStarted, "consumer")
+	if b := breaker(); b != "half-open" {
+		t.Fatalf("expected the breaker to be half-open, got %s", b)
+	}
+	clock.Advance(time.Minute)
+	if b := breaker(); b != "closed" {
+		t.Fatalf("expected the breaker to be closed, got %s", b)
+	}
+	if code := healthz(); code != http.StatusOK {
+		t.Fatalf("expected healthz to pass, got %d", code)
+	}
+
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// drainer records when it's drained and canceled.
+type drainer struct {
+	rec   *recorder
+	name  string
+	block bool
+}
+
+func (d *drainer) Run(ctx context.Context) error {
+	await.Ready(ctx)
+	<-ctx.Done()
+	d.rec.record("stop " + d.name)
+	return ctx.Err()
+}
+
+func (d *drainer) Drain(ctx context.Context) error {
+	d.rec.record("drain " + d.name)
+	if d.block {
+		<-ctx.Done()
+		if errors.Is(context.Cause(ctx), context.DeadlineExceeded) {
+			d.rec.record("drain timeout " + d.name)
+		}
+	}
+	return nil
+}
+
+func TestDrain(t *testing.T) {
+	var rec recorder
+	w := await.New(await.WithStopTimeout(time.Hour))
+	w.AddNamed(rec.runner("db"), "db", await.WithReadiness())
+	w.AddNamed(&drainer{rec: &rec, name: "http"}, "http", await.DependsOn("db"), await.WithReadiness())
+	w.AddNamed(&drainer{rec: &rec, name: "consumer", block: true}, "consumer", await.DependsOn("db"),
+		await.WithReadiness(), await.WithRunnerDrainTimeout(10*time.Millisecond))
+	release := make(chan struct{})
+	defer close(release)
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		await.Ready(ctx)
+		<-release
+		return nil
+	}), "stuck", await.WithReadiness(), await.WithRunnerStopTimeout(50*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+
+	deadline := time.Now().Add(time.Second)
+	for len(rec.get()) < 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	// the stuck runner only holds the shutdown for its own stop timeout
+	var terr *await.ShutdownTimeoutError
+	if err := <-errc; !errors.As(err, &terr) || !slices.Equal(terr.Running, []string{"stuck"}) {
+		t.Fatalf("expected stuck to time out, got %v", err)
+	}
+	events := rec.get()
+	index := func(event string) int {
+		i := slices.Index(events, event)
+		if i < 0 {
+			t.Fatalf("expected %q in %v", event, events)
+		}
+		return i
+	}
+	if index("drain http") > index("stop http") {
+		t.Fatalf("expected http to be drained before being stopped: %v", events)
+	}
+	if index("drain consumer") > index("stop consumer") {
+		t.Fatalf("expected consumer to be drained before being stopped: %v", events)
+	}
+	index("drain timeout consumer")
+	if index("stop http") > index("stop db") || index("stop consumer") > index("stop db") {
+		t.Fatalf("expected db to be stopped last: %v", events)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	boom := errors.New("boom")
+	var rec awaittest.Recorder
+	w := await.New(
+		await.WithStopTimeout(time.Second),
+		await.WithBackoff(time.Millisecond, time.Millisecond),
+		rec.Option(),
+	)
+	var attempts int32
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			return boom
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}), "flaky", await.WithRestart(await.Transient))
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}), `say "hi"`)
+
+	scrape := func() string {
+		rec := httptest.NewRecorder()
+		w.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		return rec.Body.String()
+	}
+	expect := func(body string, lines ...string) {
+		t.Helper()
+		for _, line := range lines {
+			if !strings.Contains(body, line+"\n") {
+				t.Fatalf("expected %q in:\n%s", line, body)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+	rec.WaitN(t, 2, await.EventReady, "flaky")
+	rec.Wait(t, await.EventReady, `say "hi"`)
+	expect(scrape(),
+		"await_runners_running 2",
+		`await_runner_state{runner="flaky",state="running"} 1`,
+		`await_runner_exits_total{runner="flaky",reason="error"} 1`,
+		`await_runner_restarts_total{runner="flaky"} 1`,
+		"await_shutdown_duration_seconds_count 0",
+	)
+
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expect(scrape(),
+		"# TYPE await_shutdown_duration_seconds histogram",
+		"await_runners_running 0",
+		`await_runner_state{runner="say \"hi\"",state="exited"} 1`,
+		`await_runner_exits_total{runner="flaky",reason="canceled"} 1`,
+		`await_shutdown_duration_seconds_bucket{le="+Inf"} 1`,
+		"await_shutdown_duration_seconds_count 1",
+	)
+}
+
+func TestSubgroupMetrics(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	ingest := await.New(await.WithStopTimeout(50 * time.Millisecond))
+	started := make(chan struct{})
+	ingest.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}), "stuck")
+
+	rec := &awaittest.Recorder{}
+	w := await.New(await.WithStopTimeout(time.Second), rec.Option())
+	w.AddNamed(ingest, "ingest")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	_ = w.Run(ctx)
+	rec.Wait(t, await.EventShutdownTimeout, "ingest")
+
+	scrape := func(h http.Handler) string {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		return rec.Body.String()
+	}
+	// the timeout is only counted by the subgroup whose shutdown timed out
+	if body := scrape(ingest.MetricsHandler()); !strings.Contains(body, "await_shutdown_timeouts_total 1\n") {
+		t.Fatalf("expected a timeout in the subgroup metrics:\n%s", body)
+	}
+	if body := scrape(w.MetricsHandler()); !strings.Contains(body, "await_shutdown_timeouts_total 0\n") {
+		t.Fatalf("expected no timeout in the parent metrics:\n%s", body)
+	}
+}
+
+func TestSubgroup(t *testing.T) {
+	proceed := make(chan struct{})
+	causes := make(chan *await.ShutdownCause, 1)
+	childSigc := make(chan os.Signal, 1)
+	ingest := await.New(
+		await.WithStopTimeout(time.Second),
+		await.WithSignals,
+		await.WithSignalChannel(childSigc),
+	)
+	ingest.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		<-proceed
+		await.Ready(ctx)
+		<-ctx.Done()
+		causes <- await.ShutdownCauseFrom(ctx)
+		return ctx.Err()
+	}), "kafka", await.WithReadiness())
+
+	rec := &awaittest.Recorder{}
+	sigc := make(chan os.Signal)
+	w := await.New(
+		await.WithStopTimeout(time.Second),
+		await.WithSignals,
+		await.WithSignalChannel(sigc),
+		rec.Option(),
+	)
+	w.AddNamed(ingest, "ingest", await.WithReadiness())
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}), "api", await.DependsOn("ingest"))
+
+	states := func() string {
+		var s []string
+		for _, st := range w.Status() {
+			s = append(s, st.Name+"="+st.State.String())
+		}
+		return strings.Join(s, " ")
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(context.Background()) }()
+
+	// the subgroup isn't ready until its runners are
+	rec.Wait(t, await.EventStarted, "ingest/kafka")
+	if s := states(); s != "ingest=starting ingest/kafka=starting api=pending" {
+		t.Fatalf("unexpected status %q", s)
+	}
+	close(proceed)
+	rec.Wait(t, await.EventReady, "ingest/kafka")
+	rec.Wait(t, await.EventReady, "ingest")
+	rec.Wait(t, await.EventStarted, "api")
+
+	// signals are only handled by the root group
+	childSigc <- syscall.SIGINT
+	sigc <- syscall.SIGTERM
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(childSigc) != 1 {
+		t.Fatal("expected the subgroup to ignore signals")
+	}
+	if cause := <-causes; cause == nil || cause.Reason != await.ShutdownSignal || cause.Signal != syscall.SIGTERM {
+		t.Fatalf("expected SIGTERM to cause the shutdown of the subgroup, got %v", cause)
+	}
+	rec.AssertExited(t, "api", "ingest/kafka", "ingest")
+}
+
+func TestSubgroupRestart(t *testing.T) {
+	ingest := await.New()
+	ingest.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}), "kafka")
+
+	// a restart policy is refused
+	w := await.New()
+	w.AddNamed(ingest, "ingest", await.WithRestart(await.Transient))
+	if err := w.Run(context.Background()); err == nil {
+		t.Fatal("expected an error with a restart policy")
+	}
+
+	// it's left running when its peers are restarted
+	rec := &awaittest.Recorder{}
+	w = await.New(
+		await.WithStopTimeout(time.Second),
+		await.WithStrategy(await.OneForAll),
+		await.WithBackoff(time.Millisecond, time.Millisecond),
+		rec.Option(),
+	)
+	w.AddNamed(ingest, "ingest")
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		if await.Attempt(ctx) == 1 {
+			return errors.New("boom")
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}), "flaky", await.WithRestart(await.Transient))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+	rec.WaitN(t, 2, await.EventStarted, "flaky")
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	started := rec.Names(await.EventStarted)
+	slices.Sort(started)
+	equal(t, []string{"flaky", "flaky", "ingest", "ingest/kafka"}, started)
+}
+
+func TestIdentity(t *testing.T) {
+	var buf bytes.Buffer
+	var mu sync.Mutex
+	logger := slog.New(await.LogHandler(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})))
+
+	var identities []string
+	ingest := await.New(await.WithBackoff(time.Millisecond, time.Millisecond))
+	ingest.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		mu.Lock()
+		identities = append(identities, fmt.Sprintf("%s %s %d", await.GroupPath(ctx), await.RunnerName(ctx), await.Attempt(ctx)))
+		logger.InfoContext(ctx, "consuming")
+		mu.Unlock()
+		if await.Attempt(ctx) == 1 {
+			return errors.New("boom")
+		}
+		return nil
+	}), "kafka", await.WithRestart(await.Transient))
+
+	w := await.New()
+	w.AddNamed(ingest, "ingest")
+	if err := w.Run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	equal(t, []string{"ingest kafka 1", "ingest kafka 2"}, identities)
+	expected := "level=INFO msg=consuming runner=ingest/kafka attempt=1\n" +
+		"level=INFO msg=consuming runner=ingest/kafka attempt=2\n"
+	if buf.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, buf.String())
+	}
+	if await.RunnerName(context.Background()) != "" || await.Attempt(context.Background()) != 0 {
+		t.Fatal("expected no identity outside of a runner")
+	}
+}
@@ -0,0 +1,191 @@
+package awaittest_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/runreveal/lib/await"
+	"github.com/runreveal/lib/await/awaittest"
+)
+
+func waiting(ctx context.Context) error {
+	await.Ready(ctx)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestRestartBackoff(t *testing.T) {
+	awaittest.VerifyNoLeaks(t)
+	boom := errors.New("boom")
+	clock := awaittest.NewClock(time.Unix(0, 0))
+	var rec awaittest.Recorder
+	w := await.New(
+		await.WithClock(clock),
+		await.WithBackoff(time.Minute, time.Minute),
+		rec.Option(),
+	)
+	attempts := 0
+	w.AddNamed(await.RunFunc(waiting), "db", await.WithReadiness())
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		if attempts++; attempts == 1 {
+			return boom
+		}
+		return waiting(ctx)
+	}), "consumer", await.WithRestart(await.Transient), await.DependsOn("db"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+
+	ev := rec.Wait(t, await.EventRestarting, "consumer")
+	if ev.Delay > time.Minute {
+		t.Fatalf("expected a delay of at most a minute, got %v", ev.Delay)
+	}
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	rec.WaitN(t, 2, await.EventStarted, "consumer")
+
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rec.AssertStarted(t, "db", "consumer", "consumer")
+	rec.AssertExited(t, "consumer", "consumer", "db")
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	clock := awaittest.NewClock(time.Unix(0, 0))
+	signals := awaittest.NewSignals()
+	var rec awaittest.Recorder
+	w := await.New(
+		await.WithClock(clock),
+		await.WithStopTimeout(time.Hour),
+		await.WithSignals,
+		signals.Option(),
+		rec.Option(),
+	)
+	release := make(chan struct{})
+	defer close(release)
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		await.Ready(ctx)
+		<-release
+		return nil
+	}), "stuck", await.WithReadiness())
+
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(context.Background()) }()
+
+	rec.Wait(t, await.EventReady, "stuck")
+	signals.Send(t, syscall.SIGTERM)
+	// the stop timeout only elapses once the clock is advanced
+	clock.BlockUntil(1)
+	clock.Advance(time.Hour)
+
+	err := <-errc
+	var terr *await.ShutdownTimeoutError
+	if !errors.As(err, &terr) || len(terr.Running) != 1 || terr.Running[0] != "stuck" {
+		t.Fatalf("expected a shutdown timeout, got %v", err)
+	}
+	if got := rec.Wait(t, await.EventSignal, "").Signal; got != syscall.SIGTERM {
+		t.Fatalf("expected SIGTERM, got %v", got)
+	}
+}
+
+func TestSignalDump(t *testing.T) {
+	signals := awaittest.NewSignals()
+	var dump bytes.Buffer
+	var rec awaittest.Recorder
+	w := await.New(
+		await.WithSignal(syscall.SIGUSR1, await.SignalDump),
+		await.WithDumpWriter(&dump),
+		signals.Option(),
+		rec.Option(),
+	)
+	w.AddNamed(await.RunFunc(waiting), "db")
+
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(context.Background()) }()
+	rec.Wait(t, await.EventStarted, "db")
+
+	signals.Send(t, syscall.SIGUSR1)
+	// signals without an action stop the runner
+	signals.Send(t, syscall.SIGHUP)
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(dump.String(), "db\tstate=") {
+		t.Fatalf("expected db in the dump, got:\n%s", dump.String())
+	}
+}
+
+func TestAssertExit(t *testing.T) {
+	boom := errors.New("boom")
+	w := await.New(await.WithStopTimeout(time.Second))
+	w.AddNamed(await.RunFunc(waiting), "db")
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		return boom
+	}), "failing")
+
+	err := w.Run(context.Background())
+	awaittest.AssertExit(t, err, "failing", boom)
+	awaittest.AssertExit(t, err, "db", context.Canceled)
+}
+
+// fatalTB records the failures of a test instead of failing it.
+type fatalTB struct {
+	testing.TB
+	failed string
+}
+
+func (t *fatalTB) Helper() {}
+
+func (t *fatalTB) Fatalf(format string, args ...any) {
+	t.failed = fmt.Sprintf(format, args...)
+}
+
+func TestSendTimeout(t *testing.T) {
+	defer func(d time.Duration) { awaittest.WaitTimeout = d }(awaittest.WaitTimeout)
+	awaittest.WaitTimeout = 10 * time.Millisecond
+
+	// nothing receives the signal
+	tb := &fatalTB{TB: t}
+	awaittest.NewSignals().Send(tb, syscall.SIGTERM)
+	if tb.failed == "" {
+		t.Fatal("expected Send to fail the test")
+	}
+}
+
+func TestClock(t *testing.T) {
+	clock := awaittest.NewClock(time.Unix(0, 0))
+	var fired []string
+	a := clock.NewTimer(2 * time.Second)
+	clock.AfterFunc(time.Second, func() {})
+	b := clock.NewTimer(3 * time.Second)
+
+	clock.Advance(2 * time.Second)
+	select {
+	case <-a.C():
+		fired = append(fired, "a")
+	default:
+	}
+	select {
+	case <-b.C():
+		fired = append(fired, "b")
+	default:
+	}
+	if len(fired) != 1 || fired[0] != "a" {
+		t.Fatalf("expected a to fire, got %v", fired)
+	}
+	if !b.Stop() || clock.Timers() != 0 {
+		t.Fatal("expected b to be pending")
+	}
+	if got := clock.Now(); !got.Equal(time.Unix(2, 0)) {
+		t.Fatalf("expected 2s, got %v", got)
+	}
+}
@@ -0,0 +1,123 @@
+// Package awaittest provides helpers for testing code built on await: a fake
+// clock, signal injection, assertions on the order runners start and stop in
+// and on the errors they return, and goroutine leak checks.
+package awaittest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/runreveal/lib/await"
+)
+
+// Clock is a fake await.Clock whose time only moves when Advance is called.
+// Pass it to a runner with await.WithClock.
+type Clock struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*timer
+}
+
+// NewClock returns a clock set to now.
+func NewClock(now time.Time) *Clock {
+	c := &Clock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *Clock) NewTimer(d time.Duration) await.Timer {
+	return c.add(d, make(chan time.Time, 1), nil)
+}
+
+func (c *Clock) AfterFunc(d time.Duration, f func()) await.Timer {
+	return c.add(d, nil, f)
+}
+
+func (c *Clock) add(d time.Duration, ch chan time.Time, f func()) *timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &timer{clock: c, when: c.now.Add(d), c: ch, f: f}
+	c.timers = append(c.timers, t)
+	c.cond.Broadcast()
+	return t
+}
+
+// Advance moves the clock forward by d, firing the timers which expire on the
+// way in order. Functions given to AfterFunc run in their own goroutine, as
+// with time.AfterFunc.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	end := c.now.Add(d)
+	for {
+		sort.SliceStable(c.timers, func(i, j int) bool {
+			return c.timers[i].when.Before(c.timers[j].when)
+		})
+		if len(c.timers) == 0 || c.timers[0].when.After(end) {
+			break
+		}
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		c.now = t.when
+		if t.f != nil {
+			go t.f()
+		} else {
+			select {
+			case t.c <- c.now:
+			default:
+			}
+		}
+	}
+	c.now = end
+	c.cond.Broadcast()
+}
+
+// BlockUntil blocks until at least n timers are pending, so that the clock
+// can be advanced once the code under test is waiting on it.
+func (c *Clock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.timers) < n {
+		c.cond.Wait()
+	}
+}
+
+// Timers returns the number of pending timers.
+func (c *Clock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+type timer struct {
+	clock *Clock
+	when  time.Time
+	c     chan time.Time
+	f     func()
+}
+
+func (t *timer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *timer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			c.cond.Broadcast()
+			return true
+		}
+	}
+	return false
+}
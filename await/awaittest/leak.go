@@ -0,0 +1,62 @@
+package awaittest
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// VerifyNoLeaks fails the test if goroutines started after it's called are
+// still running when the test ends, after giving them up to WaitTimeout to
+// return. Call it at the beginning of the test, before starting the runner.
+func VerifyNoLeaks(t testing.TB) {
+	t.Helper()
+	before := goroutines()
+	t.Cleanup(func() {
+		deadline := time.Now().Add(WaitTimeout)
+		for {
+			var leaked []string
+			for id, stack := range goroutines() {
+				if _, ok := before[id]; !ok {
+					leaked = append(leaked, stack)
+				}
+			}
+			if len(leaked) == 0 {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Errorf("%d leaked goroutines:\n\n%s", len(leaked), strings.Join(leaked, "\n\n"))
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
+
+// goroutines returns the stacks of the running goroutines other than the
+// calling one by goroutine id.
+func goroutines() map[string]string {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	stacks := make(map[string]string)
+	// the first stack is the calling goroutine's
+	for _, stack := range bytes.Split(buf, []byte("\n\n"))[1:] {
+		// "goroutine 42 [running]:"
+		header, _, _ := bytes.Cut(stack, []byte("\n"))
+		fields := strings.Fields(string(header))
+		if len(fields) < 2 {
+			continue
+		}
+		stacks[fields[1]] = string(stack)
+	}
+	return stacks
+}
@@ -0,0 +1,133 @@
+package awaittest
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/runreveal/lib/await"
+)
+
+// WaitTimeout bounds how long the Wait methods wait, in real time.
+var WaitTimeout = 5 * time.Second
+
+// Recorder is an await.Hook which records the lifecycle events of a runner.
+type Recorder struct {
+	mu      sync.Mutex
+	events  []await.Event
+	changed chan struct{}
+}
+
+// Option makes the runner send its events to the recorder.
+func (r *Recorder) Option() await.Option {
+	return await.WithHook(r)
+}
+
+func (r *Recorder) OnEvent(ev await.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, ev)
+	if r.changed != nil {
+		close(r.changed)
+		r.changed = nil
+	}
+}
+
+// Events returns the events recorded so far.
+func (r *Recorder) Events() []await.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.events)
+}
+
+// Names returns the names of the runners in the order of the events of the
+// given type.
+func (r *Recorder) Names(typ await.EventType) []string {
+	var names []string
+	for _, ev := range r.Events() {
+		if ev.Type == typ {
+			names = append(names, ev.Name)
+		}
+	}
+	return names
+}
+
+// Wait blocks until an event of the given type has been recorded for the
+// named runner, or fails the test after WaitTimeout. An empty name matches
+// the events of the group. It returns the first such event.
+func (r *Recorder) Wait(t testing.TB, typ await.EventType, name string) await.Event {
+	t.Helper()
+	return r.WaitN(t, 1, typ, name)
+}
+
+// WaitN is like Wait but waits for the nth such event, e.g. for the second
+// EventStarted of a runner which is restarted.
+func (r *Recorder) WaitN(t testing.TB, n int, typ await.EventType, name string) await.Event {
+	t.Helper()
+	timeout := time.After(WaitTimeout)
+	for {
+		r.mu.Lock()
+		seen := 0
+		for _, ev := range r.events {
+			if ev.Type == typ && ev.Name == name {
+				if seen++; seen == n {
+					r.mu.Unlock()
+					return ev
+				}
+			}
+		}
+		if r.changed == nil {
+			r.changed = make(chan struct{})
+		}
+		changed := r.changed
+		r.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s event %d of %q", typ, n, name)
+		}
+	}
+}
+
+// AssertStarted fails the test unless the runners were started in the given
+// order, counting restarts.
+func (r *Recorder) AssertStarted(t testing.TB, names ...string) {
+	t.Helper()
+	if got := r.Names(await.EventStarted); !slices.Equal(got, names) {
+		t.Errorf("expected runners to start in order %q, got %q", names, got)
+	}
+}
+
+// AssertExited fails the test unless the runners returned in the given
+// order, counting restarts.
+func (r *Recorder) AssertExited(t testing.TB, names ...string) {
+	t.Helper()
+	if got := r.Names(await.EventExited); !slices.Equal(got, names) {
+		t.Errorf("expected runners to exit in order %q, got %q", names, got)
+	}
+}
+
+// AssertExit fails the test unless err, as returned by Run, records that the
+// named runner returned an error matching target with errors.Is, or returned
+// no error if target is nil.
+func AssertExit(t testing.TB, err error, name string, target error) {
+	t.Helper()
+	var exitErr *await.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Errorf("expected an *await.ExitError, got %v", err)
+		return
+	}
+	for _, x := range exitErr.Exits {
+		if x.Name != name {
+			continue
+		}
+		if !errors.Is(x.Err, target) {
+			t.Errorf("expected %s to return %v, got %v", name, target, x.Err)
+		}
+		return
+	}
+	t.Errorf("expected %s to have returned", name)
+}
@@ -0,0 +1,38 @@
+package awaittest
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/runreveal/lib/await"
+)
+
+// Signals injects signals into a runner without sending them to the process.
+type Signals struct {
+	c chan os.Signal
+}
+
+// NewSignals returns a Signals, pass its Option to await.New.
+func NewSignals() *Signals {
+	return &Signals{c: make(chan os.Signal)}
+}
+
+// Option makes the runner receive the signals sent with Send instead of those
+// sent to the process. Their actions are set with await.WithSignals and
+// await.WithSignal as usual.
+func (s *Signals) Option() await.Option {
+	return await.WithSignalChannel(s.c)
+}
+
+// Send delivers sig to the runner and returns once it has been received, or
+// fails the test if it hasn't been after WaitTimeout, e.g. because the runner
+// isn't running.
+func (s *Signals) Send(t testing.TB, sig os.Signal) {
+	t.Helper()
+	select {
+	case s.c <- sig:
+	case <-time.After(WaitTimeout):
+		t.Fatalf("timed out sending signal %v", sig)
+	}
+}
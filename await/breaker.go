@@ -0,0 +1,104 @@
+package await
+
+import "time"
+
+// BreakerState is the state of the circuit breaker of a runner, see
+// WithCircuitBreaker.
+type BreakerState int
+
+const (
+	// BreakerClosed means the runner is restarted as usual.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen means the runner failed too often and its restarts are
+	// paused.
+	BreakerOpen
+	// BreakerHalfOpen means the runner was restarted after the breaker was
+	// open, and the breaker opens again if it fails before it has run for the
+	// breaker's window.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+func (s BreakerState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// breaker configures the circuit breakers of the runners.
+type breaker struct {
+	failures int
+	window   time.Duration
+	cooldown time.Duration
+}
+
+// WithCircuitBreaker detects runners stuck in a crash loop, e.g. because a
+// dependency is down. When a runner which is to be restarted (see
+// WithRestart) fails the given number of times within window, its breaker
+// opens and it isn't restarted for cooldown. It's then restarted once, and the
+// breaker closes if it runs for window without failing, or opens again
+// otherwise.
+//
+// The group keeps running while a breaker is open and reports itself as
+// unhealthy instead, see Handler and Status. The restarts of the runners
+// don't count towards the restart intensity, see WithRestartIntensity.
+func WithCircuitBreaker(failures int, window, cooldown time.Duration) Option {
+	return func(r *runner) {
+		r.breaker = &breaker{failures: failures, window: window, cooldown: cooldown}
+	}
+}
+
+// breakerState returns the state of the breaker of the entry, closing it if
+// its trial run has lasted long enough. r.mu must be held.
+func (r *runner) breakerState(e *entry, now time.Time) BreakerState {
+	if e.breaker == BreakerHalfOpen && e.running && now.Sub(e.startedAt) >= r.breaker.window {
+		e.breaker = BreakerClosed
+	}
+	return e.breaker
+}
+
+// breakerDelay records the exit of an entry which is to be restarted and
+// returns how long to wait before restarting it, and whether its breaker
+// opened.
+func (r *runner) breakerDelay(e *entry, err error, now time.Time) (time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b := r.breaker
+	state := e.breaker
+	// a trial run which lasted long enough closes the breaker
+	if state == BreakerHalfOpen && now.Sub(e.startedAt) >= b.window {
+		state = BreakerClosed
+	}
+	open := false
+	switch {
+	case !isFailure(err):
+		state = BreakerClosed
+	case state == BreakerHalfOpen:
+		open = true
+	default:
+		keep := e.breakerFailures[:0]
+		for _, t := range e.breakerFailures {
+			if now.Sub(t) < b.window {
+				keep = append(keep, t)
+			}
+		}
+		e.breakerFailures = append(keep, now)
+		open = len(e.breakerFailures) >= b.failures
+	}
+	if !open {
+		e.breaker = state
+		return r.restartDelay(e, now), false
+	}
+	e.breaker = BreakerOpen
+	e.breakerFailures = nil
+	return b.cooldown, true
+}
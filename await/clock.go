@@ -0,0 +1,65 @@
+package await
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is the source of time of a runner and of the runners it starts. It's
+// replaced in tests to control the passing of time, see WithClock.
+type Clock interface {
+	Now() time.Time
+	// NewTimer is like time.NewTimer.
+	NewTimer(d time.Duration) Timer
+	// AfterFunc is like time.AfterFunc. The returned timer's channel is nil.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a timer created by a Clock.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// WithClock sets the clock used by the runner for restart delays, stop
+// timeouts and timestamps. It's passed on to the runners it starts, see
+// ClockFrom. It defaults to the system clock.
+func WithClock(c Clock) Option {
+	return func(r *runner) {
+		r.clock = c
+	}
+}
+
+type clockKey struct{}
+
+// ClockFrom returns the clock of the runner which passed ctx, or the system
+// clock if ctx didn't come from a runner. Every, Cron, Pool and
+// ListenAndServe use it for their timers.
+func ClockFrom(ctx context.Context) Clock {
+	if c, ok := ctx.Value(clockKey{}).(Clock); ok {
+		return c
+	}
+	return systemClock{}
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return systemTimer{time.AfterFunc(d, f)}
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
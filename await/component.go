@@ -0,0 +1,120 @@
+package await
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Configurer is the configuration of a runner, such as a
+// loader.Loader[await.Runner] from github.com/runreveal/lib/loader, whose
+// factories are registered with loader.Register.
+type Configurer interface {
+	Configure() (Runner, error)
+}
+
+// Component is a runner described in configuration, so that the runners a
+// binary runs can be listed in a configuration file rather than in main. Its
+// JSON object holds the configuration of the runner, which is unmarshaled
+// into Runner, along with these fields:
+//
+//	{
+//		"type": "kafka",
+//		// the name of the runner, which other components depend on
+//		"name": "ingest",
+//		// the components which must be ready before this one starts
+//		"depends_on": ["db"],
+//		// temporary (the default), transient or permanent, see WithRestart
+//		"restart": "permanent",
+//		// whether the runner reports when it's ready, see WithReadiness
+//		"readiness": true,
+//		... the configuration of the runner
+//	}
+//
+// With the loader package, a configuration listing components is declared as:
+//
+//	type Config struct {
+//		Components []await.Component[loader.Loader[await.Runner]] `json:"components"`
+//	}
+type Component[C Configurer] struct {
+	Name      string
+	DependsOn []string
+	Restart   RestartPolicy
+	Readiness bool
+	Runner    C
+}
+
+func (c *Component[C]) UnmarshalJSON(raw []byte) error {
+	var meta struct {
+		Name      string   `json:"name"`
+		DependsOn []string `json:"depends_on"`
+		Restart   string   `json:"restart"`
+		Readiness bool     `json:"readiness"`
+	}
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return err
+	}
+	policy, err := parseRestart(meta.Restart)
+	if err != nil {
+		return fmt.Errorf("component %q: %w", meta.Name, err)
+	}
+	if err := json.Unmarshal(raw, &c.Runner); err != nil {
+		return fmt.Errorf("component %q: %w", meta.Name, err)
+	}
+	c.Name = meta.Name
+	c.DependsOn = meta.DependsOn
+	c.Restart = policy
+	c.Readiness = meta.Readiness
+	return nil
+}
+
+func parseRestart(s string) (RestartPolicy, error) {
+	switch s {
+	case "", "temporary":
+		return Temporary, nil
+	case "transient":
+		return Transient, nil
+	case "permanent":
+		return Permanent, nil
+	}
+	return 0, fmt.Errorf("unknown restart policy %q", s)
+}
+
+// Options returns the options the component's runner is added with.
+func (c Component[C]) Options() []RunnerOption {
+	opts := []RunnerOption{WithRestart(c.Restart)}
+	if len(c.DependsOn) > 0 {
+		opts = append(opts, DependsOn(c.DependsOn...))
+	}
+	if c.Readiness {
+		opts = append(opts, WithReadiness())
+	}
+	return opts
+}
+
+// AddComponents configures the runner of each component and adds it to the
+// group. No runner is added if any of them fails to be configured.
+// Dependencies between components are checked by Run.
+func AddComponents[C Configurer](w *runner, components []Component[C]) error {
+	runners := make([]Runner, len(components))
+	for i, c := range components {
+		r, err := c.Runner.Configure()
+		if err != nil {
+			return fmt.Errorf("component %q: %w", c.Name, err)
+		}
+		runners[i] = r
+	}
+	for i, c := range components {
+		w.AddNamed(runners[i], c.Name, c.Options()...)
+	}
+	return nil
+}
+
+// Compose returns a group with the given options running the components,
+// ready for Run to be called, see AddComponents.
+func Compose[C Configurer](components []Component[C], opts ...Option) (*runner, error) {
+	w := New(opts...)
+	if err := AddComponents(w, components); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
@@ -0,0 +1,96 @@
+package await_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/runreveal/lib/await"
+	"github.com/runreveal/lib/await/awaittest"
+)
+
+// workerConfig stands in for a loader.Loader[await.Runner].
+type workerConfig struct {
+	Type  string `json:"type"`
+	Label string `json:"label"`
+
+	mu      *sync.Mutex
+	started *[]string
+}
+
+func (c workerConfig) Configure() (await.Runner, error) {
+	if c.Label == "" {
+		return nil, errors.New("missing label")
+	}
+	return await.RunFunc(func(ctx context.Context) error {
+		c.mu.Lock()
+		*c.started = append(*c.started, c.Label)
+		c.mu.Unlock()
+		await.Ready(ctx)
+		<-ctx.Done()
+		return ctx.Err()
+	}), nil
+}
+
+type componentsConfig struct {
+	Components []await.Component[workerConfig] `json:"components"`
+}
+
+func TestCompose(t *testing.T) {
+	var cfg componentsConfig
+	err := json.Unmarshal([]byte(`{
+		"components": [
+			{"type": "worker", "name": "http", "depends_on": ["db"], "label": "serving http"},
+			{"type": "worker", "name": "db", "restart": "permanent", "readiness": true, "label": "connected to db"}
+		]
+	}`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := cfg.Components[1]; c.Name != "db" || c.Restart != await.Permanent || !c.Readiness || c.Runner.Type != "worker" {
+		t.Fatalf("unexpected component %+v", c)
+	}
+	var mu sync.Mutex
+	var started []string
+	for i := range cfg.Components {
+		cfg.Components[i].Runner.mu = &mu
+		cfg.Components[i].Runner.started = &started
+	}
+
+	rec := &awaittest.Recorder{}
+	w, err := await.Compose(cfg.Components, rec.Option())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+	rec.Wait(t, await.EventStarted, "http")
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	equal(t, []string{"connected to db", "serving http"}, started)
+}
+
+func TestComposeErrors(t *testing.T) {
+	var cfg componentsConfig
+	err := json.Unmarshal([]byte(`{"components": [{"type": "worker", "name": "a", "restart": "sometimes"}]}`), &cfg)
+	if err == nil {
+		t.Fatal("expected an error for an unknown restart policy")
+	}
+
+	cfg = componentsConfig{}
+	err = json.Unmarshal([]byte(`{"components": [{"type": "worker", "name": "a"}]}`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := await.Compose(cfg.Components); err == nil {
+		t.Fatal("expected an error for a component which fails to be configured")
+	}
+}
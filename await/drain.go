@@ -0,0 +1,95 @@
+package await
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Drainer is implemented by runners which can stop accepting new work while
+// finishing the work in progress, such as servers and consumers. When the
+// group shuts down, Drain is called before the runner's context is canceled,
+// and the context is canceled once Drain returns or the drain timeout
+// elapses, see WithRunnerDrainTimeout. Drain is called concurrently with Run,
+// which keeps running until its context is canceled, and may return early.
+type Drainer interface {
+	Drain(ctx context.Context) error
+}
+
+// errDrained is the cause given to a Pool's source when it's drained.
+var errDrained = errors.New("await: drained")
+
+// WithRunnerStopTimeout sets how long the runner is given to return once its
+// phase begins stopping, including the time it's given to drain, instead of
+// its share of the group's stop timeout (see WithStopTimeout).
+func WithRunnerStopTimeout(d time.Duration) RunnerOption {
+	return func(e *entry) {
+		e.stopTimeout = d
+	}
+}
+
+// WithRunnerDrainTimeout sets how long a runner implementing Drainer is given
+// to drain before its context is canceled. It defaults to half of its stop
+// timeout, and can't be longer than the stop timeout.
+func WithRunnerDrainTimeout(d time.Duration) RunnerOption {
+	return func(e *entry) {
+		e.drainTimeout = d
+	}
+}
+
+// stop drains the entry if it's a Drainer and cancels it, in a new goroutine.
+// The returned channel is closed once the entry has returned or its stop
+// timeout, which defaults to the given one, has elapsed. r.mu must be held.
+func (r *runner) stop(e *entry, cause error, timeout time.Duration) <-chan struct{} {
+	if e.stopTimeout > 0 {
+		timeout = e.stopTimeout
+	}
+	drainTimeout := timeout / 2
+	if e.drainTimeout > 0 {
+		drainTimeout = min(e.drainTimeout, timeout)
+	}
+	ctx, cancel, done := e.ctx, e.cancel, e.done
+	drainer, drain := e.run.(Drainer)
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		timer := r.clock.NewTimer(timeout)
+		defer timer.Stop()
+		if drain {
+			r.drain(ctx, e, drainer, drainTimeout, done)
+		}
+		cancel(cause)
+		select {
+		case <-done:
+		case <-timer.C():
+		}
+	}()
+	return stopped
+}
+
+// drain calls Drain and returns once it has, the entry has returned or the
+// timeout has elapsed.
+func (r *runner) drain(ctx context.Context, e *entry, d Drainer, timeout time.Duration, done <-chan struct{}) {
+	r.emit(Event{Type: EventDraining, Name: e.String()})
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	timer := r.clock.AfterFunc(timeout, func() {
+		cancel(context.DeadlineExceeded)
+	})
+	defer timer.Stop()
+
+	drained := make(chan error, 1)
+	go func() {
+		drained <- d.Drain(ctx)
+	}()
+	select {
+	case err := <-drained:
+		if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+			r.log().Error("await: drain failed", "name", e.String(), "err", err)
+		}
+	case <-done:
+	case <-ctx.Done():
+		r.log().Warn("await: drain timeout", "name", e.String(), "timeout", timeout)
+	}
+}
@@ -0,0 +1,168 @@
+package await
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrNotRunning is returned by Launch once Run has returned.
+var ErrNotRunning = errors.New("await: not running")
+
+// errRemoved is the cause given to runners stopped by Remove.
+var errRemoved = errors.New("await: removed")
+
+type launchRequest struct {
+	e     *entry
+	reply chan error
+}
+
+type removeRequest struct {
+	name  string
+	reply chan *entry
+}
+
+// Launch adds a runner to the group while it's running and starts it right
+// away, or once its dependencies are ready (see DependsOn). The runner takes part in the group like any other: it's stopped on
+// shutdown, within the stop timeout, and its errors and restarts are handled
+// according to the group's options. Unlike with AddNamed, the name must be
+// unique among the runners which haven't finished, and dependencies must
+// already be part of the group.
+//
+// Before Run is called, Launch is equivalent to AddNamed.
+func (r *runner) Launch(f Runner, name string, opts ...RunnerOption) error {
+	if name == "" {
+		return errors.New("await: Launch requires a name")
+	}
+	e := &entry{run: f, group: r, name: name}
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	r.startMu.Lock()
+	if !r.started {
+		e.idx = len(r.entries)
+		r.entries = append(r.entries, e)
+		r.startMu.Unlock()
+		return nil
+	}
+	r.startMu.Unlock()
+
+	req := launchRequest{e: e, reply: make(chan error, 1)}
+	select {
+	case r.launchc <- req:
+		return <-req.reply
+	case <-r.halted:
+		return ErrNotRunning
+	}
+}
+
+// Remove stops the named runner without stopping the rest of the group, and
+// removes it from the group. It waits for the runner to return, or for ctx to
+// be done. Removing a runner which doesn't exist does nothing.
+//
+// Before Run is called, Remove removes the runners added with the given name.
+func (r *runner) Remove(ctx context.Context, name string) error {
+	r.startMu.Lock()
+	if !r.started {
+		r.entries = slices.DeleteFunc(r.entries, func(e *entry) bool {
+			return e.name == name
+		})
+		r.startMu.Unlock()
+		return nil
+	}
+	r.startMu.Unlock()
+
+	req := removeRequest{name: name, reply: make(chan *entry, 1)}
+	select {
+	case r.removec <- req:
+	case <-r.halted:
+		return nil
+	}
+	e := <-req.reply
+	if e == nil {
+		return nil
+	}
+	r.mu.Lock()
+	done := e.done
+	r.mu.Unlock()
+	if done == nil {
+		// it was never started
+		return nil
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// lookup returns the entry with the given name which hasn't finished or been
+// removed, if any.
+func (r *runner) lookup(name string) *entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.entries {
+		if e.name == name && !e.finished && !e.removed {
+			return e
+		}
+	}
+	return nil
+}
+
+// addRunning adds an entry to the group while it's running.
+func (r *runner) addRunning(e *entry) error {
+	if err := e.checkRestart(); err != nil {
+		return err
+	}
+	if r.lookup(e.name) != nil {
+		return fmt.Errorf("await: runner %q already exists", e.name)
+	}
+	for _, name := range e.deps {
+		dep := r.lookup(name)
+		if dep == nil {
+			return fmt.Errorf("await: %q depends on unknown runner %q", e, name)
+		}
+		e.phase = max(e.phase, dep.phase+1)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e.idx = len(r.entries)
+	e.readyc = make(chan struct{})
+	r.entries = append(r.entries, e)
+	for len(r.phases) <= e.phase {
+		r.phases = append(r.phases, nil)
+	}
+	r.phases[e.phase] = append(r.phases[e.phase], e)
+	return nil
+}
+
+// pendingDeps returns the readiness channels of the dependencies of the entry
+// which aren't ready yet.
+func (r *runner) pendingDeps(e *entry) []<-chan struct{} {
+	var deps []<-chan struct{}
+	for _, name := range e.deps {
+		dep := r.lookup(name)
+		if dep == nil {
+			continue
+		}
+		r.mu.Lock()
+		if !dep.readyClosed() {
+			deps = append(deps, dep.readyc)
+		}
+		r.mu.Unlock()
+	}
+	return deps
+}
+
+// drop removes an entry from the group.
+func (r *runner) drop(e *entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	isEntry := func(x *entry) bool { return x == e }
+	r.entries = slices.DeleteFunc(r.entries, isEntry)
+	r.phases[e.phase] = slices.DeleteFunc(r.phases[e.phase], isEntry)
+}
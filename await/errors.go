@@ -0,0 +1,236 @@
+package await
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime/pprof"
+	"strings"
+	"time"
+)
+
+// labelKey is the pprof label set on the goroutines of each runner to the
+// runner's name, so that they can be told apart in goroutine dumps.
+const labelKey = "await.runner"
+
+// ShutdownTimeoutError is returned by Run when some runners haven't returned
+// by the time the stop timeout elapses, or when the shutdown was forced.
+type ShutdownTimeoutError struct {
+	// Running lists the names of the runners which were still running.
+	Running []string
+	// Stacks holds the goroutine profile of those runners, including any
+	// goroutines they started, if WithStackDump was given.
+	Stacks []byte
+	// Err is the error which caused the shutdown, if any.
+	Err error
+	// Forced is set if the wait was cut short by a second stop signal rather
+	// than by the stop timeout.
+	Forced bool
+}
+
+func (e *ShutdownTimeoutError) Error() string {
+	reason := "timeout"
+	if e.Forced {
+		reason = "forced"
+	}
+	msg := "await: shutdown " + reason + ", still running: " + strings.Join(e.Running, ", ")
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *ShutdownTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// stacks returns the records of the goroutine profile which are labeled with
+// one of the given runner names.
+func stacks(names []string) []byte {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		return nil
+	}
+
+	var out bytes.Buffer
+	for _, record := range strings.Split(buf.String(), "\n\n") {
+		for _, name := range names {
+			if strings.Contains(record, fmt.Sprintf("%q:%q", labelKey, name)) {
+				out.WriteString(record)
+				out.WriteString("\n\n")
+				break
+			}
+		}
+	}
+	return out.Bytes()
+}
+
+// ShutdownReason identifies why a runner's group is shutting down.
+type ShutdownReason int
+
+const (
+	// ShutdownSignal means a stop signal was received.
+	ShutdownSignal ShutdownReason = iota + 1
+	// ShutdownPeerFailed means another runner returned an error, or had to be
+	// restarted too many times.
+	ShutdownPeerFailed
+	// ShutdownPeerDone means another runner returned nil.
+	ShutdownPeerDone
+	// ShutdownParent means the context passed to Run was canceled.
+	ShutdownParent
+	// ShutdownUpgrade means a new process took over after SignalUpgrade.
+	ShutdownUpgrade
+)
+
+func (r ShutdownReason) String() string {
+	switch r {
+	case ShutdownSignal:
+		return "signal"
+	case ShutdownPeerFailed:
+		return "peer failed"
+	case ShutdownPeerDone:
+		return "peer done"
+	case ShutdownParent:
+		return "parent"
+	case ShutdownUpgrade:
+		return "upgrade"
+	}
+	return "unknown"
+}
+
+// ShutdownCause is the cause of the cancellation of the context of each
+// runner when its group shuts down, which lets runners choose how to stop,
+// e.g. flushing buffered data on a signal but not when a peer failed. Get it
+// with ShutdownCauseFrom.
+type ShutdownCause struct {
+	Reason ShutdownReason
+	// Signal is set for ShutdownSignal.
+	Signal os.Signal
+	// Runner is the name of the peer for ShutdownPeerFailed and
+	// ShutdownPeerDone.
+	Runner string
+	// Err is the error of the peer for ShutdownPeerFailed, and the cause of
+	// the cancellation of the parent context for ShutdownParent.
+	Err error
+}
+
+func (c *ShutdownCause) Error() string {
+	switch c.Reason {
+	case ShutdownSignal:
+		return fmt.Sprintf("await: shutdown on signal %v", c.Signal)
+	case ShutdownPeerFailed:
+		return fmt.Sprintf("await: shutdown: %s: %v", c.Runner, c.Err)
+	case ShutdownPeerDone:
+		return fmt.Sprintf("await: shutdown: %s returned", c.Runner)
+	case ShutdownParent:
+		return fmt.Sprintf("await: shutdown: %v", c.Err)
+	case ShutdownUpgrade:
+		return "await: shutdown after upgrade"
+	}
+	return "await: shutdown"
+}
+
+func (c *ShutdownCause) Unwrap() error {
+	return c.Err
+}
+
+// ShutdownCauseFrom returns the cause of the shutdown of the group if ctx is
+// the context of a runner which was canceled because of it, or nil.
+func ShutdownCauseFrom(ctx context.Context) *ShutdownCause {
+	var cause *ShutdownCause
+	if errors.As(context.Cause(ctx), &cause) {
+		return cause
+	}
+	return nil
+}
+
+// PanicError is returned in place of the error of a runner which panicked,
+// when WithRecover is given.
+type PanicError struct {
+	// Name is the name of the runner which panicked.
+	Name string
+	// Value is the value passed to panic.
+	Value any
+	// Stack is the stack trace of the goroutine at the time of the panic.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("await: runner %s panicked: %v", e.Name, e.Value)
+}
+
+// Unwrap returns the value passed to panic if it's an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// Exit records how a runner returned.
+type Exit struct {
+	// Name is the name of the runner.
+	Name string
+	// Err is the error the runner returned.
+	Err error
+	// Time is when the runner returned.
+	Time time.Time
+	// Trigger is set if the runner returning began the shutdown.
+	Trigger bool
+}
+
+// ExitError is returned by Run when the shutdown was caused by an error, when
+// a runner returned an error while shutting down, or when the stop timeout
+// elapsed. It unwraps to all of these errors, so errors.Is and errors.As can
+// be used to check for any of them.
+type ExitError struct {
+	// Err is the error which caused the shutdown, wrapped in a
+	// *ShutdownTimeoutError if the stop timeout elapsed.
+	Err error
+	// Exits records the last exit of each runner which returned, in the order
+	// they returned.
+	Exits []Exit
+}
+
+func (e *ExitError) Error() string {
+	var b strings.Builder
+	if e.Err != nil {
+		b.WriteString(e.Err.Error())
+	}
+	for _, x := range e.secondary() {
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "%s: %v", x.Name, x.Err)
+	}
+	return b.String()
+}
+
+// Unwrap returns the error which caused the shutdown followed by the errors
+// returned by the other runners.
+func (e *ExitError) Unwrap() []error {
+	var errs []error
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	for _, x := range e.secondary() {
+		errs = append(errs, x.Err)
+	}
+	return errs
+}
+
+// secondary returns the failed exits which didn't trigger the shutdown.
+func (e *ExitError) secondary() []Exit {
+	var exits []Exit
+	for _, x := range e.Exits {
+		if !x.Trigger && isFailure(x.Err) {
+			exits = append(exits, x)
+		}
+	}
+	return exits
+}
+
+// isFailure reports whether a runner returning err counts as a failure.
+func isFailure(err error) bool {
+	return err != nil && !errors.Is(err, context.Canceled)
+}
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package await
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// FileLock returns a Locker backed by flock(2), which is only available on
+// unix systems. Elsewhere the returned Locker always fails.
+func FileLock(path string, interval time.Duration) Locker {
+	return unsupportedLock{}
+}
+
+type unsupportedLock struct{}
+
+func (unsupportedLock) Lock(ctx context.Context) (Lease, error) {
+	return nil, errors.New("await: file locks require a unix system")
+}
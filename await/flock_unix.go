@@ -0,0 +1,129 @@
+//go:build unix
+
+package await
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FileLock returns a Locker backed by flock(2) on the file at path, which is
+// created if needed. Since flock can't be interrupted, the lock is retried
+// every interval while it's held by another process. A held lock is
+// considered lost if the file is removed or replaced, which is also checked
+// every interval. The interval defaults to a second when zero.
+func FileLock(path string, interval time.Duration) Locker {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &fileLock{path: path, interval: interval}
+}
+
+type fileLock struct {
+	path     string
+	interval time.Duration
+}
+
+func (l *fileLock) Lock(ctx context.Context) (Lease, error) {
+	for {
+		f, err := l.tryLock()
+		if err != nil {
+			return nil, err
+		}
+		if f != nil {
+			lease := &fileLease{path: l.path, f: f, lost: make(chan struct{}), done: make(chan struct{})}
+			go lease.watch(l.interval)
+			return lease, nil
+		}
+		timer := time.NewTimer(l.interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// tryLock returns the locked file, or nil if the lock is held elsewhere.
+func (l *fileLock) tryLock() (*os.File, error) {
+	f, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		f.Close()
+		return nil, nil
+	}
+	if err != nil {
+		f.Close()
+		return nil, &os.PathError{Op: "flock", Path: l.path, Err: err}
+	}
+	// the file may have been removed by its previous holder between the open
+	// and the flock, in which case the lock is worthless
+	if !sameFile(f, l.path) {
+		f.Close()
+		return nil, nil
+	}
+	// record the holder to ease debugging, failing to do so is harmless
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return f, nil
+}
+
+func sameFile(f *os.File, path string) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	pi, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(fi, pi)
+}
+
+type fileLease struct {
+	path string
+	f    *os.File
+	lost chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+func (l *fileLease) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+			if !sameFile(l.f, l.path) {
+				close(l.lost)
+				return
+			}
+		}
+	}
+}
+
+func (l *fileLease) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *fileLease) Unlock() error {
+	err := os.ErrClosed
+	l.once.Do(func() {
+		close(l.done)
+		// closing the file releases the lock
+		err = l.f.Close()
+	})
+	return err
+}
@@ -0,0 +1,100 @@
+package await
+
+import (
+	"context"
+	"errors"
+)
+
+// A group added to another group with Add, AddNamed or Launch is run as its
+// subgroup: the names of its runners are prefixed with the name of the group
+// in its parent, as in "ingest/kafka", and its status, readiness, events and
+// shutdown causes are visible from the parent:
+//
+//   - Status, Handler and MetricsHandler of the parent include the runners of
+//     the subgroup
+//   - the subgroup is ready once all of its runners are, and not ready while
+//     any of them isn't
+//   - its events are also sent to the hooks of the parent, and it logs with
+//     the parent's logger unless WithLogger was given
+//   - when the parent shuts down, the runners of the subgroup see the
+//     parent's ShutdownCause
+//
+// Signals, systemd notifications and upgrades are only handled by the root
+// group, and the options setting them are ignored in subgroups.
+//
+// Since a group can only be run once, a subgroup can't be restarted: Run
+// returns an error if it's given a restart policy (see WithRestart), and it's
+// left running when the other runners are restarted with the OneForAll
+// strategy. Its own runners are restarted according to its own options.
+
+// runOnce marks groups as not restartable, since Run can only be called once.
+func (r *runner) runOnce() {}
+
+// subgroup attaches a group to its parent before it's started. It's called
+// with the entry of the group in the parent. r.mu must be held.
+func (r *runner) subgroup(e *entry) {
+	g, ok := e.run.(*runner)
+	if !ok || g == r {
+		return
+	}
+	g.parent = r
+	g.prefix = e.String()
+}
+
+// path returns the name of a runner of the group as seen from the root.
+func (r *runner) path(name string) string {
+	if r == nil || r.prefix == "" {
+		return name
+	}
+	return r.prefix + "/" + name
+}
+
+// parentCause returns the cause of the shutdown of the parent group, if ctx
+// was canceled because of it.
+func (r *runner) parentCause(ctx context.Context) *ShutdownCause {
+	var cause *ShutdownCause
+	if r.parent != nil && errors.As(context.Cause(ctx), &cause) {
+		return cause
+	}
+	return nil
+}
+
+// updateReady reports the subgroup as ready in its parent while all of its
+// runners which haven't finished are ready, once it has started.
+func (r *runner) updateReady() {
+	if r.parent == nil {
+		return
+	}
+	r.mu.Lock()
+	if !r.reported || r.stopping {
+		r.mu.Unlock()
+		return
+	}
+	ready := true
+	for _, e := range r.entries {
+		if !e.finished && !e.removed && !(e.running && e.isReady) {
+			ready = false
+		}
+	}
+	ctx := r.runCtx
+	r.mu.Unlock()
+	if ready {
+		Ready(ctx)
+	} else {
+		NotReady(ctx)
+	}
+}
+
+// children returns the subgroups among the running entries. r.mu must be held.
+func (r *runner) children() map[*entry]*runner {
+	var children map[*entry]*runner
+	for _, e := range r.entries {
+		if g, ok := e.run.(*runner); ok && g.parent == r && !e.startedAt.IsZero() {
+			if children == nil {
+				children = make(map[*entry]*runner)
+			}
+			children[e] = g
+		}
+	}
+	return children
+}
@@ -0,0 +1,110 @@
+package await
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Handler returns an http.Handler which serves /healthz and /readyz for use
+// as liveness and readiness probes.
+//
+// /healthz succeeds while Run is in progress and every runner which hasn't
+// finished for good is running, i.e. none is waiting to be restarted,
+// including after its circuit breaker opened (see WithCircuitBreaker).
+// /readyz succeeds while every such runner is ready, and fails once shutdown
+// has begun so that traffic is drained before the runners are stopped.
+//
+// Both list the state of each runner in the response body.
+func (r *runner) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, req *http.Request) {
+		r.serveProbe(w, "healthz", func(e *entry) (bool, string) {
+			if e.running {
+				return true, "ok"
+			}
+			if e.breaker == BreakerOpen {
+				return false, "circuit open"
+			}
+			return false, "not running"
+		})
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, req *http.Request) {
+		r.serveProbe(w, "readyz", func(e *entry) (bool, string) {
+			if e.running && e.isReady {
+				return true, "ok"
+			}
+			return false, "not ready"
+		})
+	})
+	return mux
+}
+
+func (r *runner) serveProbe(w http.ResponseWriter, probe string, check func(*entry) (bool, string)) {
+	r.startMu.Lock()
+	started := r.started
+	r.startMu.Unlock()
+
+	var b strings.Builder
+	ok := started
+	if !started {
+		b.WriteString("[-]await not started\n")
+	}
+
+	r.mu.Lock()
+	if probe == "readyz" && r.stopping {
+		ok = false
+		b.WriteString("[-]await shutting down\n")
+	}
+	r.mu.Unlock()
+	if !r.probe(&b, check) {
+		ok = false
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if ok {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(&b, "%s check passed\n", probe)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(&b, "%s check failed\n", probe)
+	}
+	_, _ = w.Write([]byte(b.String()))
+}
+
+// probe writes the result of check for every runner, including the runners
+// of subgroups, and reports whether they all passed.
+func (r *runner) probe(b *strings.Builder, check func(*entry) (bool, string)) bool {
+	type result struct {
+		line  string
+		group *runner
+	}
+	ok := true
+	r.mu.Lock()
+	children := r.children()
+	results := make([]result, 0, len(r.entries))
+	for _, e := range r.entries {
+		if e.finished {
+			results = append(results, result{line: fmt.Sprintf("[+]%s finished\n", e)})
+			continue
+		}
+		pass, msg := check(e)
+		sign := "+"
+		if !pass {
+			ok = false
+			sign = "-"
+		}
+		results = append(results, result{fmt.Sprintf("[%s]%s %s\n", sign, e, msg), children[e]})
+	}
+	r.mu.Unlock()
+
+	// the runners of a subgroup follow the subgroup, and are checked without
+	// holding the lock of the parent
+	for _, res := range results {
+		b.WriteString(res.line)
+		if res.group != nil && !res.group.probe(b, check) {
+			ok = false
+		}
+	}
+	return ok
+}
@@ -0,0 +1,142 @@
+package await
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// EventType identifies a lifecycle event.
+type EventType int
+
+const (
+	// EventStarted is emitted when a runner is started or restarted.
+	EventStarted EventType = iota + 1
+	// EventReady is emitted when a runner becomes ready.
+	EventReady
+	// EventExited is emitted when a runner returns. Err holds its error.
+	EventExited
+	// EventRestarting is emitted when a runner is scheduled to be restarted
+	// after Delay. Err holds the error it returned.
+	EventRestarting
+	// EventSignal is emitted when a signal is received.
+	EventSignal
+	// EventShutdown is emitted when shutdown begins. Err holds the error which
+	// caused it, if any.
+	EventShutdown
+	// EventShutdownTimeout is emitted when the stop timeout elapses before all
+	// runners have returned. Err holds the *ShutdownTimeoutError.
+	EventShutdownTimeout
+	// EventCircuitOpen is emitted when the circuit breaker of a runner opens,
+	// pausing its restarts for Delay. Err holds the error it returned. See
+	// WithCircuitBreaker.
+	EventCircuitOpen
+	// EventDraining is emitted when Drain is called on a runner during
+	// shutdown, see Drainer.
+	EventDraining
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventStarted:
+		return "started"
+	case EventReady:
+		return "ready"
+	case EventExited:
+		return "exited"
+	case EventRestarting:
+		return "restarting"
+	case EventSignal:
+		return "signal"
+	case EventShutdown:
+		return "shutdown"
+	case EventShutdownTimeout:
+		return "shutdown timeout"
+	case EventCircuitOpen:
+		return "circuit open"
+	case EventDraining:
+		return "draining"
+	}
+	return "unknown"
+}
+
+// Event describes something which happened to a runner or to the group.
+type Event struct {
+	Type EventType
+	Time time.Time
+	// Name is the name of the runner, empty for events about the group.
+	Name string
+	Err  error
+	// Signal is set for EventSignal.
+	Signal os.Signal
+	// Delay is set for EventRestarting.
+	Delay time.Duration
+}
+
+// Hook receives lifecycle events. It's called synchronously from several
+// goroutines, so it must be safe for concurrent use and shouldn't block.
+type Hook interface {
+	OnEvent(Event)
+}
+
+// HookFunc adapts a function to the Hook interface.
+type HookFunc func(Event)
+
+func (f HookFunc) OnEvent(ev Event) {
+	f(ev)
+}
+
+// WithHook adds a hook which receives the lifecycle events of the runner.
+func WithHook(h Hook) Option {
+	return func(r *runner) {
+		r.hooks = append(r.hooks, h)
+	}
+}
+
+// WithLogger sets the logger used by the runner. It defaults to
+// slog.Default().
+func WithLogger(l *slog.Logger) Option {
+	return func(r *runner) {
+		r.logger = l
+	}
+}
+
+func (r *runner) log() *slog.Logger {
+	if r.logger != nil {
+		return r.logger
+	}
+	if r.parent != nil {
+		return r.parent.log()
+	}
+	return slog.Default()
+}
+
+type loggerKey struct{}
+
+// loggerFrom returns the logger of the runner which was passed ctx, with the
+// runner's name attached, or slog.Default() if ctx didn't come from a runner.
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+func (r *runner) emit(ev Event) {
+	r.metrics.observe(ev)
+	if ev.Time.IsZero() {
+		ev.Time = r.clock.Now()
+	}
+	for _, h := range r.hooks {
+		h.OnEvent(ev)
+	}
+	if r.parent != nil {
+		// the events about a subgroup as a whole are about the entry of the
+		// group in its parent
+		if ev.Name == "" {
+			ev.Name = r.prefix
+		}
+		r.parent.emit(ev)
+	}
+}
@@ -0,0 +1,107 @@
+package await
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+type identityKey struct{}
+
+// identity is attached to the context passed to each runner.
+type identity struct {
+	name    string
+	group   string
+	attempt int
+}
+
+func (id *identity) path() string {
+	if id.group == "" {
+		return id.name
+	}
+	return id.group + "/" + id.name
+}
+
+// withIdentity returns ctx carrying the identity of the entry. r.mu must be
+// held.
+func (r *runner) withIdentity(ctx context.Context, e *entry) context.Context {
+	name := e.name
+	if name == "" {
+		name = fmt.Sprintf("#%d", e.idx)
+	}
+	return context.WithValue(ctx, identityKey{}, &identity{name: name, group: r.prefix, attempt: e.attempts})
+}
+
+// RunnerName returns the name of the runner which was passed ctx, as given to
+// AddNamed or Launch, or "#n" for the nth runner added without a name. It
+// returns "" if ctx didn't come from a runner.
+func RunnerName(ctx context.Context) string {
+	if id, ok := ctx.Value(identityKey{}).(*identity); ok {
+		return id.name
+	}
+	return ""
+}
+
+// GroupPath returns the path of the subgroup the runner which was passed ctx
+// belongs to, as in "ingest" for the runner "ingest/kafka". It returns "" for
+// the runners of the root group and if ctx didn't come from a runner.
+func GroupPath(ctx context.Context) string {
+	if id, ok := ctx.Value(identityKey{}).(*identity); ok {
+		return id.group
+	}
+	return ""
+}
+
+// Attempt returns how many times the runner which was passed ctx has been
+// started, 1 for its first run. It returns 0 if ctx didn't come from a runner.
+func Attempt(ctx context.Context) int {
+	if id, ok := ctx.Value(identityKey{}).(*identity); ok {
+		return id.attempt
+	}
+	return 0
+}
+
+// LogHandler wraps an slog.Handler to add the identity of the runner to the
+// records logged with its context, as in slog.InfoContext(ctx, ...): the
+// "runner" attribute holds its path, as in "ingest/kafka", and "attempt" its
+// attempt number. Records logged without a runner's context are passed on
+// unchanged.
+func LogHandler(h slog.Handler) slog.Handler {
+	return &logHandler{h: h}
+}
+
+type logHandler struct {
+	h slog.Handler
+	// named is set once the "runner" attribute has been added with WithAttrs,
+	// e.g. by the logger of the runner itself
+	named bool
+}
+
+func (h *logHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.h.Enabled(ctx, level)
+}
+
+func (h *logHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if id, ok := ctx.Value(identityKey{}).(*identity); ok {
+		rec = rec.Clone()
+		if !h.named {
+			rec.AddAttrs(slog.String("runner", id.path()))
+		}
+		rec.AddAttrs(slog.Int("attempt", id.attempt))
+	}
+	return h.h.Handle(ctx, rec)
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	named := h.named
+	for _, a := range attrs {
+		if a.Key == "runner" {
+			named = true
+		}
+	}
+	return &logHandler{h: h.h.WithAttrs(attrs), named: named}
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	return &logHandler{h: h.h.WithGroup(name), named: h.named}
+}
@@ -0,0 +1,73 @@
+package await
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrLockLost is the cause of the cancellation of a runner wrapped by Leader
+// when its lock is lost.
+var ErrLockLost = errors.New("await: lock lost")
+
+// Locker acquires an exclusive lock, such as a file lock or a lease held in a
+// distributed store.
+type Locker interface {
+	// Lock blocks until the lock is acquired or ctx is canceled.
+	Lock(ctx context.Context) (Lease, error)
+}
+
+// Lease is a held lock.
+type Lease interface {
+	// Lost returns a channel which is closed if the lock is lost while held.
+	Lost() <-chan struct{}
+	// Unlock releases the lock.
+	Unlock() error
+}
+
+// Leader returns a runner which only runs run while holding the lock from l.
+// If the lock is lost, run's context is canceled with ErrLockLost as its cause
+// and the runner contends for the lock again once run has returned. The
+// runner is ready as soon as it's started, since waiting for the lock is its
+// normal state on all but one replica.
+func Leader(l Locker, run Runner) Runner {
+	return &leader{locker: l, run: run}
+}
+
+type leader struct {
+	locker Locker
+	run    Runner
+}
+
+func (l *leader) Run(ctx context.Context) error {
+	Ready(ctx)
+	log := loggerFrom(ctx)
+	for {
+		lease, err := l.locker.Lock(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		log.Info("await: acquired lock")
+
+		runCtx, cancel := context.WithCancelCause(ctx)
+		go func() {
+			select {
+			case <-lease.Lost():
+				cancel(ErrLockLost)
+			case <-runCtx.Done():
+			}
+		}()
+		err = l.run.Run(runCtx)
+		lost := errors.Is(context.Cause(runCtx), ErrLockLost)
+		cancel(nil)
+		if uerr := lease.Unlock(); uerr != nil && !lost {
+			log.Error("await: releasing lock", "err", uerr)
+		}
+		if !lost || ctx.Err() != nil {
+			return err
+		}
+		log.Warn("await: lost lock", "err", err)
+	}
+}
@@ -0,0 +1,70 @@
+//go:build unix
+
+package await_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/runreveal/lib/await"
+)
+
+func TestLeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leader.lock")
+	leading := make(chan string, 4)
+	leader := func(name string) await.Runner {
+		return await.Leader(await.FileLock(path, 10*time.Millisecond), await.RunFunc(func(ctx context.Context) error {
+			leading <- name
+			<-ctx.Done()
+			if !errors.Is(context.Cause(ctx), await.ErrLockLost) {
+				leading <- name + " stopped"
+			}
+			return ctx.Err()
+		}))
+	}
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	defer cancelA()
+	errA := make(chan error, 1)
+	go func() { errA <- leader("a").Run(ctxA) }()
+	if name := <-leading; name != "a" {
+		t.Fatalf("expected a to lead, got %s", name)
+	}
+
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+	errB := make(chan error, 1)
+	go func() { errB <- leader("b").Run(ctxB) }()
+	select {
+	case name := <-leading:
+		t.Fatalf("expected a single leader, got %s", name)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancelA()
+	if err := <-errA; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if name := <-leading; name != "a stopped" {
+		t.Fatalf("expected a to stop, got %s", name)
+	}
+	if name := <-leading; name != "b" {
+		t.Fatalf("expected b to lead, got %s", name)
+	}
+
+	// removing the file loses the lock, which b then takes again
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if name := <-leading; name != "b" {
+		t.Fatalf("expected b to lead again, got %s", name)
+	}
+	cancelB()
+	if err := <-errB; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+package await
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// shutdownBuckets are the upper bounds of the buckets of the shutdown duration
+// histogram, in seconds.
+var shutdownBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// metrics counts the lifecycle events of a runner.
+type metrics struct {
+	mu       sync.Mutex
+	exits    map[exitKey]uint64
+	restarts map[string]uint64
+	opens    map[string]uint64
+	timeouts uint64
+	// shutdown duration histogram
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+type exitKey struct {
+	name, reason string
+}
+
+// exitReason classifies the error returned by a runner.
+func exitReason(err error) string {
+	var perr *PanicError
+	switch {
+	case err == nil:
+		return "completed"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.As(err, &perr):
+		return "panic"
+	}
+	return "error"
+}
+
+// observe updates the metrics with an event.
+func (m *metrics) observe(ev Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch ev.Type {
+	case EventExited:
+		if m.exits == nil {
+			m.exits = make(map[exitKey]uint64)
+		}
+		m.exits[exitKey{ev.Name, exitReason(ev.Err)}]++
+	case EventRestarting:
+		if m.restarts == nil {
+			m.restarts = make(map[string]uint64)
+		}
+		m.restarts[ev.Name]++
+	case EventCircuitOpen:
+		if m.opens == nil {
+			m.opens = make(map[string]uint64)
+		}
+		m.opens[ev.Name]++
+	case EventShutdownTimeout:
+		// only count the shutdowns of this group, not those of its subgroups
+		// which are forwarded with the name of their entry
+		if ev.Name == "" {
+			m.timeouts++
+		}
+	}
+}
+
+// observeShutdown records how long a shutdown took.
+func (m *metrics) observeShutdown(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.buckets == nil {
+		m.buckets = make([]uint64, len(shutdownBuckets))
+	}
+	s := d.Seconds()
+	for i, le := range shutdownBuckets {
+		if s <= le {
+			m.buckets[i]++
+		}
+	}
+	m.sum += s
+	m.count++
+}
+
+// MetricsHandler returns an http.Handler which serves metrics about the
+// runners in the Prometheus text exposition format:
+//
+//   - await_runners_running, the number of runners running
+//   - await_runner_state, set to 1 for the current state of each runner
+//   - await_runner_breaker_open, set to 1 while the circuit breaker of a
+//     runner is open, see WithCircuitBreaker
+//   - await_runner_exits_total, the number of times each runner returned by
+//     reason: completed, canceled, error or panic
+//   - await_runner_restarts_total, the number of restarts of each runner
+//   - await_runner_breaker_opens_total, the number of times the circuit
+//     breaker of each runner opened
+//   - await_shutdown_timeouts_total, the number of shutdowns which timed out
+//   - await_shutdown_duration_seconds, a histogram of the duration of
+//     shutdowns
+func (r *runner) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		r.writeMetrics(bw)
+		_ = bw.Flush()
+	})
+}
+
+func (r *runner) writeMetrics(w *bufio.Writer) {
+	statuses := r.Status()
+	running := 0
+	for _, s := range statuses {
+		if s.State != StatePending && s.State != StateExited && s.State != StateRestarting {
+			running++
+		}
+	}
+	header(w, "await_runners_running", "gauge", "Number of runners running.")
+	fmt.Fprintf(w, "await_runners_running %d\n", running)
+
+	header(w, "await_runner_state", "gauge", "Current state of each runner.")
+	for _, s := range statuses {
+		fmt.Fprintf(w, "await_runner_state{runner=%s,state=%s} 1\n", label(s.Name), label(s.State.String()))
+	}
+	if r.breaker != nil {
+		header(w, "await_runner_breaker_open", "gauge", "Whether the circuit breaker of each runner is open.")
+		for _, s := range statuses {
+			open := 0
+			if s.Breaker == BreakerOpen {
+				open = 1
+			}
+			fmt.Fprintf(w, "await_runner_breaker_open{runner=%s} %d\n", label(s.Name), open)
+		}
+	}
+
+	m := &r.metrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	header(w, "await_runner_exits_total", "counter", "Number of times each runner returned, by reason.")
+	keys := make([]exitKey, 0, len(m.exits))
+	for k := range m.exits {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].name != keys[j].name {
+			return keys[i].name < keys[j].name
+		}
+		return keys[i].reason < keys[j].reason
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "await_runner_exits_total{runner=%s,reason=%s} %d\n", label(k.name), label(k.reason), m.exits[k])
+	}
+
+	header(w, "await_runner_restarts_total", "counter", "Number of restarts of each runner.")
+	writeCounters(w, "await_runner_restarts_total", m.restarts)
+	if r.breaker != nil {
+		header(w, "await_runner_breaker_opens_total", "counter", "Number of times the circuit breaker of each runner opened.")
+		writeCounters(w, "await_runner_breaker_opens_total", m.opens)
+	}
+
+	header(w, "await_shutdown_timeouts_total", "counter", "Number of shutdowns which timed out.")
+	fmt.Fprintf(w, "await_shutdown_timeouts_total %d\n", m.timeouts)
+
+	header(w, "await_shutdown_duration_seconds", "histogram", "Duration of shutdowns.")
+	for i, le := range shutdownBuckets {
+		var n uint64
+		if m.buckets != nil {
+			n = m.buckets[i]
+		}
+		fmt.Fprintf(w, "await_shutdown_duration_seconds_bucket{le=\"%g\"} %d\n", le, n)
+	}
+	fmt.Fprintf(w, "await_shutdown_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.count)
+	fmt.Fprintf(w, "await_shutdown_duration_seconds_sum %g\n", m.sum)
+	fmt.Fprintf(w, "await_shutdown_duration_seconds_count %d\n", m.count)
+}
+
+func header(w *bufio.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeCounters(w *bufio.Writer, name string, counters map[string]uint64) {
+	names := make([]string, 0, len(counters))
+	for n := range counters {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		fmt.Fprintf(w, "%s{runner=%s} %d\n", name, label(n), counters[n])
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// label quotes a label value.
+func label(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
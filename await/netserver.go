@@ -0,0 +1,195 @@
+package await
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// Server is a network server such as a *grpc.Server. Serve serves on l until
+// the server is stopped, GracefulStop stops it from accepting connections and
+// waits for those in flight to finish, and Stop closes them right away.
+type Server interface {
+	Serve(l net.Listener) error
+	GracefulStop()
+	Stop()
+}
+
+// PacketServer is a server of datagrams such as a syslog receiver over UDP.
+// ServePacket serves on conn until the server is stopped, GracefulStop stops
+// it from reading datagrams and waits for those being handled, and Stop
+// returns right away. The server doesn't own conn: once GracefulStop or Stop
+// has returned, the conns opened with WithPacketAddr are closed, and those
+// given with WithPacketConn are left for their owner to close.
+type PacketServer interface {
+	ServePacket(conn net.PacketConn) error
+	GracefulStop()
+	Stop()
+}
+
+// WithPacketConn makes the server returned by ServePacket serve on an already
+// bound packet conn. It may be given several times to serve on several conns.
+func WithPacketConn(c net.PacketConn) ServerOption {
+	return func(s *serverConfig) {
+		s.packetConns = append(s.packetConns, func() (net.PacketConn, bool, error) {
+			return c, false, nil
+		})
+	}
+}
+
+// WithPacketAddr makes the server returned by ServePacket listen on the given
+// network and address, see net.ListenPacket. It may be given several times to
+// listen on several addresses. Unlike listeners, packet conns aren't passed
+// on to the new process on upgrade (see SignalUpgrade).
+func WithPacketAddr(network, addr string) ServerOption {
+	return func(s *serverConfig) {
+		s.packetConns = append(s.packetConns, func() (net.PacketConn, bool, error) {
+			c, err := net.ListenPacket(network, addr)
+			return c, true, err
+		})
+	}
+}
+
+type netServer struct {
+	serving
+	server interface {
+		GracefulStop()
+		Stop()
+	}
+	// open opens the listeners or packet conns and returns a function
+	// serving on each of them, and one closing what it opened
+	open func() (serve []func() error, close func(), err error)
+}
+
+// Serve provides a graceful shutdown for a Server, like ListenAndServe does
+// for an http.Server.
+// usage: `w.Add(await.Serve(grpcServer, await.WithAddr("tcp", ":9090")))`
+//
+// It serves on the listeners given with WithAddr, WithListener and
+// WithUnixSocket, and reports itself as ready (see Ready) once it's
+// listening. When its context is canceled it calls GracefulStop, and Stop if
+// the connections in flight haven't finished within the shutdown timeout (see
+// WithShutdownTimeout). WithTLS and WithH2C don't apply to it.
+//
+// Since servers such as a *grpc.Server can't be used again once they have
+// been stopped, the runner can't be restarted, like the one returned by
+// ListenAndServe.
+func Serve(server Server, opts ...ServerOption) Runner {
+	s := &netServer{server: server, serving: serving{serverConfig: newServerConfig(opts)}}
+	s.open = func() ([]func() error, func(), error) {
+		listeners, err := s.listen("")
+		if err != nil {
+			return nil, nil, err
+		}
+		serve := make([]func() error, len(listeners))
+		for i, l := range listeners {
+			l := l
+			serve[i] = func() error { return server.Serve(l) }
+		}
+		// the server closes the listeners it serves on
+		return serve, func() {}, nil
+	}
+	return s
+}
+
+// ServePacket is like Serve for a PacketServer, which serves on the packet
+// conns given with WithPacketConn and WithPacketAddr.
+func ServePacket(server PacketServer, opts ...ServerOption) Runner {
+	s := &netServer{server: server, serving: serving{serverConfig: newServerConfig(opts)}}
+	s.open = func() ([]func() error, func(), error) {
+		conns, opened, err := s.listenPacket()
+		if err != nil {
+			return nil, nil, err
+		}
+		serve := make([]func() error, len(conns))
+		for i, c := range conns {
+			c := c
+			serve[i] = func() error { return server.ServePacket(c) }
+		}
+		return serve, func() {
+			for _, c := range opened {
+				c.Close()
+			}
+		}, nil
+	}
+	return s
+}
+
+// runOnce marks the runner as not restartable, see Serve.
+func (s *netServer) runOnce() {}
+
+func (s *netServer) Run(ctx context.Context) error {
+	serve, closeAll, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer closeAll()
+
+	// any error returned once Drain has stopped the server is expected
+	closed := func(error) bool { return true }
+	return s.serve(ctx, serve, closed, s.server.Stop, func() error {
+		timer := ClockFrom(ctx).NewTimer(s.shutdownTimeout)
+		defer timer.Stop()
+		return s.gracefulStop(timer.C())
+	})
+}
+
+// Drain stops the server from accepting connections and waits for the
+// connections in flight to finish, see Drainer. With WithDrainDelay, the
+// server first reports itself as not ready and keeps serving for the delay.
+func (s *netServer) Drain(ctx context.Context) error {
+	return s.drain(ctx, func(ctx context.Context) error {
+		done := make(chan struct{})
+		go func() {
+			s.server.GracefulStop()
+			close(done)
+		}()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// gracefulStop calls GracefulStop, and Stop if it hasn't returned when
+// timeout fires, in which case it returns context.DeadlineExceeded.
+func (s *netServer) gracefulStop(timeout <-chan time.Time) error {
+	done := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-timeout:
+		s.server.Stop()
+		<-done
+		return context.DeadlineExceeded
+	}
+}
+
+// listenPacket opens all of the packet conns, and returns them along with
+// those it opened rather than having been given.
+func (s *serverConfig) listenPacket() (conns, opened []net.PacketConn, err error) {
+	if len(s.packetConns) == 0 {
+		return nil, nil, errors.New("await: no address to listen on")
+	}
+	for _, fn := range s.packetConns {
+		c, open, err := fn()
+		if err != nil {
+			for _, c := range opened {
+				c.Close()
+			}
+			return nil, nil, err
+		}
+		conns = append(conns, c)
+		if open {
+			opened = append(opened, c)
+		}
+	}
+	return conns, opened, nil
+}
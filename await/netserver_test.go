@@ -0,0 +1,254 @@
+package await_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/runreveal/lib/await"
+	"github.com/runreveal/lib/await/awaittest"
+)
+
+// echoServer is an await.Server which echoes what its clients send.
+type echoServer struct {
+	mu        sync.Mutex
+	stopped   bool
+	listeners []net.Listener
+	conns     map[net.Conn]struct{}
+	wg        sync.WaitGroup
+}
+
+func (s *echoServer) Serve(l net.Listener) error {
+	s.mu.Lock()
+	s.listeners = append(s.listeners, l)
+	s.mu.Unlock()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.stopped {
+				return nil
+			}
+			return err
+		}
+		s.mu.Lock()
+		if s.conns == nil {
+			s.conns = make(map[net.Conn]struct{})
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go func() {
+			defer s.wg.Done()
+			_, _ = io.Copy(conn, conn)
+			conn.Close()
+		}()
+	}
+}
+
+func (s *echoServer) GracefulStop() {
+	s.mu.Lock()
+	s.stopped = true
+	for _, l := range s.listeners {
+		l.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *echoServer) Stop() {
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.GracefulStop()
+}
+
+func TestServe(t *testing.T) {
+	echo := func(t *testing.T, conn net.Conn) {
+		t.Helper()
+		if _, err := io.WriteString(conn, "hello"); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != "hello" {
+			t.Fatalf("unexpected reply %q", buf)
+		}
+	}
+	serve := func(t *testing.T, opts ...await.ServerOption) (net.Conn, *awaittest.Recorder, context.CancelFunc, <-chan error) {
+		t.Helper()
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := &awaittest.Recorder{}
+		w := await.New(await.WithStopTimeout(time.Second), rec.Option())
+		w.AddNamed(await.Serve(&echoServer{}, append(opts, await.WithListener(l))...), "echo",
+			await.WithReadiness(), await.WithRunnerDrainTimeout(10*time.Millisecond))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errc := make(chan error, 1)
+		go func() { errc <- w.Run(ctx) }()
+		rec.Wait(t, await.EventReady, "echo")
+
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		echo(t, conn)
+		return conn, rec, cancel, errc
+	}
+
+	t.Run("graceful", func(t *testing.T) {
+		conn, rec, cancel, errc := serve(t)
+		// the connection in flight is served until it's closed
+		cancel()
+		rec.Wait(t, await.EventDraining, "echo")
+		echo(t, conn)
+		conn.Close()
+		if err := <-errc; err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("forced", func(t *testing.T) {
+		conn, _, cancel, errc := serve(t, await.WithShutdownTimeout(10*time.Millisecond))
+		// the connection in flight is closed after the shutdown timeout
+		cancel()
+		if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+			t.Fatalf("expected the connection to be closed, got %v", err)
+		}
+		if err := <-errc; !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+		}
+	})
+
+	t.Run("no address", func(t *testing.T) {
+		w := await.New()
+		w.Add(await.Serve(&echoServer{}))
+		if err := w.Run(context.Background()); err == nil {
+			t.Fatal("expected an error without a listener")
+		}
+	})
+}
+
+// packetEchoServer is an await.PacketServer which echoes the datagrams it
+// receives. It leaves closing its conns to the adapter.
+type packetEchoServer struct {
+	mu      sync.Mutex
+	stopped bool
+	conns   []net.PacketConn
+	wg      sync.WaitGroup
+}
+
+func (s *packetEchoServer) ServePacket(c net.PacketConn) error {
+	s.mu.Lock()
+	s.conns = append(s.conns, c)
+	s.wg.Add(1)
+	s.mu.Unlock()
+	defer s.wg.Done()
+	buf := make([]byte, 1024)
+	for {
+		n, addr, err := c.ReadFrom(buf)
+		if err != nil {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.stopped {
+				return nil
+			}
+			return err
+		}
+		if _, err := c.WriteTo(buf[:n], addr); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *packetEchoServer) GracefulStop() {
+	s.mu.Lock()
+	s.stopped = true
+	for _, c := range s.conns {
+		_ = c.SetReadDeadline(time.Unix(1, 0))
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *packetEchoServer) Stop() {
+	s.GracefulStop()
+}
+
+func TestServePacket(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &packetEchoServer{}
+	rec := &awaittest.Recorder{}
+	w := await.New(await.WithStopTimeout(time.Second), rec.Option())
+	w.AddNamed(await.ServePacket(server,
+		await.WithPacketConn(pc),
+		await.WithPacketAddr("udp", "127.0.0.1:0"),
+	), "syslog", await.WithReadiness())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+	rec.Wait(t, await.EventReady, "syslog")
+
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "hello" {
+		t.Fatalf("unexpected reply %q", buf[:n])
+	}
+
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the conn it opened is closed, the other one is left open
+	server.mu.Lock()
+	conns := server.conns
+	server.mu.Unlock()
+	if len(conns) != 2 {
+		t.Fatalf("expected 2 conns, got %d", len(conns))
+	}
+	for _, c := range conns {
+		err := c.Close()
+		if c == pc && err != nil {
+			t.Fatalf("expected the conn given to be left open, got %v", err)
+		}
+		if c != pc && !errors.Is(err, net.ErrClosed) {
+			t.Fatalf("expected the conn opened to be closed, got %v", err)
+		}
+	}
+
+	// packet conns must be given
+	w = await.New()
+	w.Add(await.ServePacket(&packetEchoServer{}, await.WithAddr("tcp", "127.0.0.1:0")))
+	if err := w.Run(context.Background()); err == nil {
+		t.Fatal("expected an error without a packet conn")
+	}
+}
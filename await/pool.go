@@ -0,0 +1,272 @@
+package await
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// Source produces the items processed by a Pool. Next blocks until an item is
+// available or ctx is canceled, and returns io.EOF once there are no more
+// items. Any other error stops the pool.
+type Source[T any] interface {
+	Next(ctx context.Context) (T, error)
+}
+
+// SourceFunc adapts a function to the Source interface.
+type SourceFunc[T any] func(ctx context.Context) (T, error)
+
+func (f SourceFunc[T]) Next(ctx context.Context) (T, error) {
+	return f(ctx)
+}
+
+// ChanSource returns a Source which receives items from c until it's closed.
+func ChanSource[T any](c <-chan T) Source[T] {
+	return SourceFunc[T](func(ctx context.Context) (T, error) {
+		select {
+		case item, ok := <-c:
+			if !ok {
+				return item, io.EOF
+			}
+			return item, nil
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		}
+	})
+}
+
+// ErrorPolicy determines what a Pool does when handling an item fails.
+type ErrorPolicy int
+
+const (
+	// ErrorLog logs the error and moves on to the next item. This is the
+	// default.
+	ErrorLog ErrorPolicy = iota
+	// ErrorStop stops the pool, which returns the error once the items being
+	// handled are done.
+	ErrorStop
+	// ErrorRetry retries the item with backoff (see WithRetries), and logs the
+	// error if it still fails.
+	ErrorRetry
+)
+
+// PoolOption configures a Pool.
+type PoolOption func(*poolConfig)
+
+type poolConfig struct {
+	policy       ErrorPolicy
+	retries      int
+	backoff      Backoff
+	drainTimeout time.Duration
+}
+
+// WithErrorPolicy sets what the pool does when handling an item fails.
+func WithErrorPolicy(p ErrorPolicy) PoolOption {
+	return func(c *poolConfig) {
+		c.policy = p
+	}
+}
+
+// WithRetries sets how many times an item is retried with the ErrorRetry
+// policy and the backoff between attempts. It defaults to 3 retries with a
+// backoff between 100ms and 10s.
+func WithRetries(n int, backoff Backoff) PoolOption {
+	return func(c *poolConfig) {
+		c.retries = n
+		c.backoff = backoff
+	}
+}
+
+// WithDrainTimeout bounds how long the items being handled when the pool is
+// stopped are given to finish, after which the context passed to the handler
+// is canceled. By default they're given as long as they need, within the stop
+// timeout of the runner.
+func WithDrainTimeout(d time.Duration) PoolOption {
+	return func(c *poolConfig) {
+		c.drainTimeout = d
+	}
+}
+
+// Pool is a Runner which handles items from a Source with a bounded number of
+// goroutines. When its context is canceled it stops taking items from the
+// source and returns once the items being handled are done. The handlers are
+// passed a context which isn't canceled along with the pool's, so that they
+// can finish, see WithDrainTimeout.
+type Pool[T any] struct {
+	src    Source[T]
+	handle func(context.Context, T) error
+	cfg    poolConfig
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	size int
+	// set while running
+	pullCtx   context.Context
+	stop      context.CancelCauseFunc
+	handleCtx context.Context
+	workers   []context.CancelFunc
+	active    int
+}
+
+// NewPool returns a Pool which handles the items from src with handle, using
+// up to size goroutines.
+func NewPool[T any](src Source[T], handle func(context.Context, T) error, size int, opts ...PoolOption) *Pool[T] {
+	p := &Pool[T]{
+		src:    src,
+		handle: handle,
+		size:   size,
+		cfg: poolConfig{
+			retries: 3,
+			backoff: Backoff{Min: 100 * time.Millisecond, Max: 10 * time.Second},
+		},
+	}
+	p.cond = sync.NewCond(&p.mu)
+	for _, opt := range opts {
+		opt(&p.cfg)
+	}
+	return p
+}
+
+// Size returns the number of goroutines the pool uses.
+func (p *Pool[T]) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.size
+}
+
+// Resize changes the number of goroutines the pool uses. When shrinking, the
+// goroutines which are let go finish the item they're handling first.
+func (p *Pool[T]) Resize(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.size = max(n, 0)
+	if p.pullCtx != nil && p.pullCtx.Err() == nil {
+		p.resize()
+	}
+}
+
+// resize starts or stops workers to match the size. p.mu must be held.
+func (p *Pool[T]) resize() {
+	for len(p.workers) < p.size {
+		ctx, cancel := context.WithCancel(p.pullCtx)
+		p.workers = append(p.workers, cancel)
+		p.active++
+		go p.work(ctx)
+	}
+	for len(p.workers) > p.size {
+		p.workers[len(p.workers)-1]()
+		p.workers = p.workers[:len(p.workers)-1]
+	}
+}
+
+func (p *Pool[T]) Run(ctx context.Context) error {
+	p.mu.Lock()
+	if p.pullCtx != nil {
+		p.mu.Unlock()
+		return errors.New("await: pool is already running")
+	}
+	p.pullCtx, p.stop = context.WithCancelCause(ctx)
+	handleCtx, cancelHandle := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelHandle()
+	p.handleCtx = handleCtx
+	p.resize()
+	pullCtx := p.pullCtx
+	p.mu.Unlock()
+	Ready(ctx)
+
+	<-pullCtx.Done()
+	if p.cfg.drainTimeout > 0 {
+		t := ClockFrom(ctx).AfterFunc(p.cfg.drainTimeout, cancelHandle)
+		defer t.Stop()
+	}
+
+	p.mu.Lock()
+	for _, cancel := range p.workers {
+		cancel()
+	}
+	for p.active > 0 {
+		p.cond.Wait()
+	}
+	p.pullCtx, p.stop, p.handleCtx, p.workers = nil, nil, nil, nil
+	p.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := context.Cause(pullCtx); !errors.Is(err, io.EOF) && !errors.Is(err, errDrained) {
+		return err
+	}
+	return nil
+}
+
+// Drain stops the pool from taking items from the source, see Drainer. Run
+// returns once the items being handled are done.
+func (p *Pool[T]) Drain(ctx context.Context) error {
+	p.mu.Lock()
+	stop := p.stop
+	p.mu.Unlock()
+	if stop != nil {
+		stop(errDrained)
+	}
+	return nil
+}
+
+func (p *Pool[T]) work(ctx context.Context) {
+	p.mu.Lock()
+	stop, handleCtx := p.stop, p.handleCtx
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.active--
+		p.cond.Broadcast()
+		p.mu.Unlock()
+	}()
+
+	for {
+		item, err := p.src.Next(ctx)
+		if err != nil {
+			// the pool is stopping, or this worker was let go
+			if ctx.Err() != nil {
+				return
+			}
+			stop(err)
+			return
+		}
+		if err := p.process(handleCtx, item); err != nil {
+			stop(err)
+			return
+		}
+	}
+}
+
+// process handles the item according to the error policy, and returns an
+// error if the pool should stop.
+func (p *Pool[T]) process(ctx context.Context, item T) error {
+	err := p.handle(ctx, item)
+	if err == nil {
+		return nil
+	}
+	switch p.cfg.policy {
+	case ErrorStop:
+		return err
+	case ErrorRetry:
+		for i := 0; err != nil && i < p.cfg.retries; i++ {
+			timer := ClockFrom(ctx).NewTimer(p.cfg.backoff.delay(i))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil
+			case <-timer.C():
+			}
+			err = p.handle(ctx, item)
+		}
+		if err == nil {
+			return nil
+		}
+	}
+	loggerFrom(ctx).Error("await: pool item failed", "err", err)
+	return nil
+}
@@ -0,0 +1,95 @@
+package await_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/runreveal/lib/await"
+)
+
+func TestPool(t *testing.T) {
+	items := make(chan int)
+	var (
+		mu     sync.Mutex
+		seen   = map[int]bool{}
+		active int32
+		peak   int32
+	)
+	pool := await.NewPool(await.ChanSource(items), func(ctx context.Context, item int) error {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		seen[item] = true
+		mu.Unlock()
+		return nil
+	}, 2)
+
+	w := await.New(await.WithStopTimeout(time.Second))
+	w.AddNamed(pool, "pool")
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(context.Background()) }()
+
+	for i := 0; i < 20; i++ {
+		items <- i
+	}
+	pool.Resize(4)
+	for i := 20; i < 40; i++ {
+		items <- i
+	}
+	close(items)
+
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(seen) != 40 {
+		t.Fatalf("expected 40 items, got %d", len(seen))
+	}
+	if p := atomic.LoadInt32(&peak); p > 4 {
+		t.Fatalf("expected at most 4 concurrent items, got %d", p)
+	}
+}
+
+func TestPoolErrorPolicy(t *testing.T) {
+	boom := errors.New("boom")
+	items := make(chan int, 3)
+	items <- 1
+	items <- 2
+	close(items)
+
+	var attempts int32
+	handle := func(ctx context.Context, item int) error {
+		atomic.AddInt32(&attempts, 1)
+		if item == 2 {
+			return boom
+		}
+		return nil
+	}
+	pool := await.NewPool(await.ChanSource(items), handle, 1,
+		await.WithErrorPolicy(await.ErrorRetry),
+		await.WithRetries(2, await.Backoff{Min: time.Millisecond, Max: time.Millisecond}),
+	)
+	if err := pool.Run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 4 {
+		t.Fatalf("expected 4 attempts, got %d", n)
+	}
+
+	items = make(chan int, 1)
+	items <- 2
+	pool = await.NewPool(await.ChanSource(items), handle, 1, await.WithErrorPolicy(await.ErrorStop))
+	if err := pool.Run(context.Background()); !errors.Is(err, boom) {
+		t.Fatalf("expected %v, got %v", boom, err)
+	}
+}
@@ -0,0 +1,77 @@
+package await
+
+import (
+	"context"
+	"sync"
+)
+
+type readyKey struct{}
+
+// notifier tracks the readiness of a single run of an entry.
+type notifier struct {
+	r     *runner
+	e     *entry
+	ready chan struct{}
+	once  sync.Once
+}
+
+func (n *notifier) set(ready bool) {
+	n.r.mu.Lock()
+	// a notifier from a previous run of the entry must not change its state
+	current := n.e.notifier == n
+	changed := current && n.e.isReady != ready
+	if current {
+		n.e.isReady = ready
+		if ready && !n.e.readyClosed() {
+			close(n.e.readyc)
+		}
+	}
+	n.r.mu.Unlock()
+	if changed && ready {
+		n.r.emit(Event{Type: EventReady, Name: n.e.String()})
+	}
+	if changed {
+		n.r.updateReady()
+	}
+	if ready {
+		n.once.Do(func() { close(n.ready) })
+	}
+}
+
+// readyClosed reports whether the readiness channel of the entry has been
+// closed. The runner's mu must be held.
+func (e *entry) readyClosed() bool {
+	select {
+	case <-e.readyc:
+		return true
+	default:
+		return false
+	}
+}
+
+// WithReadiness declares that the runner reports when it is ready by calling
+// Ready with the context passed to its Run method. Until it does, runners
+// depending on it aren't started and it is reported as not ready. Runners
+// added without this option are considered ready as soon as they're started.
+func WithReadiness() RunnerOption {
+	return func(e *entry) {
+		e.waitReady = true
+	}
+}
+
+// Ready marks the runner which was passed ctx as ready. It does nothing if ctx
+// didn't come from a runner.
+func Ready(ctx context.Context) {
+	if n, ok := ctx.Value(readyKey{}).(*notifier); ok {
+		n.set(true)
+	}
+}
+
+// NotReady marks the runner which was passed ctx as not ready, for example
+// while it's draining. It doesn't affect runners which have already been
+// started because of an earlier call to Ready.
+func NotReady(ctx context.Context) {
+	if n, ok := ctx.Value(readyKey{}).(*notifier); ok {
+		n.set(false)
+	}
+}
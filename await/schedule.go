@@ -0,0 +1,145 @@
+package await
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// JobOption configures the runners returned by Every and Cron.
+type JobOption func(*job)
+
+// WithJitter delays each run of the job by a random duration up to d, to
+// avoid many processes running the same job at the same instant.
+func WithJitter(d time.Duration) JobOption {
+	return func(j *job) {
+		j.jitter = d
+	}
+}
+
+// WithImmediate runs the job as soon as it's started, in addition to its
+// schedule.
+func WithImmediate() JobOption {
+	return func(j *job) {
+		j.immediate = true
+	}
+}
+
+// WithLocation sets the location cron expressions are evaluated in, unless
+// the expression sets one itself with CRON_TZ.
+func WithLocation(loc *time.Location) JobOption {
+	return func(j *job) {
+		j.loc = loc
+	}
+}
+
+// WithStopOnError makes the runner return the first error returned by the
+// job, so that it can be handled like any other runner error, for example by
+// restarting it (see WithRestart). By default errors are logged and the job
+// keeps running on its schedule.
+func WithStopOnError() JobOption {
+	return func(j *job) {
+		j.stopOnError = true
+	}
+}
+
+type job struct {
+	run         Runner
+	next        func(time.Time) time.Time
+	jitter      time.Duration
+	immediate   bool
+	loc         *time.Location
+	stopOnError bool
+}
+
+// Every returns a runner which runs job every interval until its context is
+// canceled. The job runs in the runner's goroutine, so a run which is still
+// going when the next one is due causes that run to be skipped rather than
+// overlapping, and panics are handled like panics in any other runner (see
+// WithRecover). It panics if interval isn't positive, like time.NewTicker.
+func Every(interval time.Duration, job Runner, opts ...JobOption) Runner {
+	if interval <= 0 {
+		panic(errors.New("await: non-positive interval for Every"))
+	}
+	return newJob(job, func(t time.Time) time.Time {
+		return t.Add(interval)
+	}, opts)
+}
+
+// Cron returns a runner which runs job on the schedule given by the cron
+// expression, see ParseCron. It behaves like Every otherwise.
+func Cron(expr string, job Runner, opts ...JobOption) (Runner, error) {
+	sched, err := ParseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+	j := newJob(job, nil, opts)
+	if j.loc != nil && !sched.tz {
+		sched = sched.In(j.loc)
+	}
+	j.next = sched.Next
+	return j, nil
+}
+
+func newJob(run Runner, next func(time.Time) time.Time, opts []JobOption) *job {
+	j := &job{run: run, next: next}
+	for _, opt := range opts {
+		opt(j)
+	}
+	return j
+}
+
+func (j *job) Run(ctx context.Context) error {
+	Ready(ctx)
+	log := loggerFrom(ctx)
+	clock := ClockFrom(ctx)
+
+	now := clock.Now()
+	due := now
+	if !j.immediate {
+		due = j.next(now)
+	}
+	for {
+		if due.IsZero() {
+			// the schedule will never fire again
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		wait := due.Sub(clock.Now())
+		if j.jitter > 0 {
+			wait += time.Duration(rand.Int63n(int64(j.jitter)))
+		}
+		timer := clock.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C():
+		}
+
+		start := clock.Now()
+		err := j.run.Run(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			if j.stopOnError {
+				return err
+			}
+			log.Error("await: job failed", "err", err, "duration", clock.Now().Sub(start))
+		}
+
+		// skip the runs which were due while this one was running
+		skipped := 0
+		now = clock.Now()
+		due = j.next(due)
+		for !due.IsZero() && due.Before(now) {
+			due = j.next(due)
+			skipped++
+		}
+		if skipped > 0 {
+			log.Warn("await: job skipped runs", "skipped", skipped, "duration", clock.Now().Sub(start))
+		}
+	}
+}
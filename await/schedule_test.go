@@ -0,0 +1,143 @@
+package await_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/runreveal/lib/await"
+	"github.com/runreveal/lib/await/awaittest"
+)
+
+func TestParseCron(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip(err)
+	}
+	start := time.Date(2024, time.January, 31, 10, 30, 0, 0, time.UTC) // a wednesday
+
+	tests := []struct {
+		expr     string
+		expected time.Time
+		err      bool
+	}{
+		{expr: "* * * * *", expected: time.Date(2024, 1, 31, 10, 31, 0, 0, time.UTC)},
+		{expr: "*/15 * * * *", expected: time.Date(2024, 1, 31, 10, 45, 0, 0, time.UTC)},
+		{expr: "0 9-17 * * MON-FRI", expected: time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC)},
+		{expr: "0 0 29 FEB *", expected: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 1,15 * 7", expected: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{expr: "@daily", expected: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{expr: "@weekly", expected: time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC)},
+		{expr: "CRON_TZ=Europe/Paris 0 9 * * *", expected: time.Date(2024, 2, 1, 9, 0, 0, 0, paris)},
+		{expr: "0 0 30 2 *", expected: time.Time{}},
+		{expr: "* * * *", err: true},
+		{expr: "60 * * * *", err: true},
+		{expr: "*/0 * * * *", err: true},
+		{expr: "5-1 * * * *", err: true},
+		{expr: "CRON_TZ=Nowhere/Special * * * * *", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := await.ParseCron(tt.expr)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if next := s.Next(start); !next.Equal(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, next)
+			}
+		})
+	}
+}
+
+func TestEvery(t *testing.T) {
+	var runs int32
+	boom := errors.New("boom")
+	job := await.Every(time.Millisecond, await.RunFunc(func(ctx context.Context) error {
+		if atomic.AddInt32(&runs, 1) == 3 {
+			return boom
+		}
+		return nil
+	}), await.WithImmediate(), await.WithStopOnError())
+
+	w := await.New(await.WithStopTimeout(time.Second))
+	w.AddNamed(job, "job")
+	if err := w.Run(context.Background()); !errors.Is(err, boom) {
+		t.Fatalf("expected %v, got %v", boom, err)
+	}
+	if n := atomic.LoadInt32(&runs); n != 3 {
+		t.Fatalf("expected 3 runs, got %d", n)
+	}
+}
+
+func TestEveryNonPositive(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected Every to panic with a non-positive interval")
+		}
+	}()
+	await.Every(0, await.RunFunc(func(ctx context.Context) error { return nil }))
+}
+
+func TestCronLocation(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip(err)
+	}
+	start := time.Date(2024, time.January, 31, 0, 0, 0, 0, time.UTC)
+
+	run := func(t *testing.T, expr string) (*awaittest.Clock, <-chan struct{}) {
+		t.Helper()
+		ran := make(chan struct{}, 1)
+		job, err := await.Cron(expr, await.RunFunc(func(ctx context.Context) error {
+			ran <- struct{}{}
+			return nil
+		}), await.WithLocation(paris))
+		if err != nil {
+			t.Fatal(err)
+		}
+		clock := awaittest.NewClock(start)
+		w := await.New(await.WithClock(clock), await.WithStopTimeout(time.Second))
+		w.AddNamed(job, "job")
+		ctx, cancel := context.WithCancel(context.Background())
+		errc := make(chan error, 1)
+		go func() { errc <- w.Run(ctx) }()
+		t.Cleanup(func() {
+			cancel()
+			<-errc
+		})
+		clock.BlockUntil(1)
+		return clock, ran
+	}
+
+	// without CRON_TZ, 9:00 is evaluated in Paris, at 8:00 UTC
+	clock, ran := run(t, "0 9 * * *")
+	clock.Advance(8*time.Hour + time.Minute)
+	select {
+	case <-ran:
+	case <-time.After(awaittest.WaitTimeout):
+		t.Fatal("expected the job to run at 8:00 UTC")
+	}
+
+	// CRON_TZ takes precedence over WithLocation
+	clock, ran = run(t, "CRON_TZ=UTC 0 9 * * *")
+	clock.Advance(8*time.Hour + time.Minute)
+	select {
+	case <-ran:
+		t.Fatal("expected the job not to run at 8:00 UTC")
+	case <-time.After(10 * time.Millisecond):
+	}
+	clock.Advance(time.Hour)
+	select {
+	case <-ran:
+	case <-time.After(awaittest.WaitTimeout):
+		t.Fatal("expected the job to run at 9:00 UTC")
+	}
+}
@@ -0,0 +1,367 @@
+package await
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ServerOption configures the runners returned by ListenAndServe, Serve and
+// ServePacket.
+type ServerOption func(*serverConfig)
+
+// WithListener makes the server serve on an already bound listener. It may be
+// given several times to serve on several listeners.
+func WithListener(l net.Listener) ServerOption {
+	return func(s *serverConfig) {
+		s.listeners = append(s.listeners, func() (net.Listener, error) {
+			return l, nil
+		})
+	}
+}
+
+// WithAddr makes the server listen on the given network and address, see
+// net.Listen. It may be given several times to listen on several addresses.
+func WithAddr(network, addr string) ServerOption {
+	return func(s *serverConfig) {
+		s.listeners = append(s.listeners, func() (net.Listener, error) {
+			return listen(network, addr)
+		})
+	}
+}
+
+// WithUnixSocket makes the server listen on a unix domain socket at path. A
+// stale socket left at path by a previous process is removed first.
+func WithUnixSocket(path string) ServerOption {
+	return func(s *serverConfig) {
+		s.listeners = append(s.listeners, func() (net.Listener, error) {
+			if l := inherit("unix", path); l != nil {
+				return l, nil
+			}
+			if fi, err := os.Stat(path); err == nil && fi.Mode().Type() == fs.ModeSocket {
+				if err := os.Remove(path); err != nil {
+					return nil, err
+				}
+			}
+			return listen("unix", path)
+		})
+	}
+}
+
+// WithTLS makes the HTTP server serve TLS with the given certificate and key.
+// The files are reloaded when the runner's Reload method is called, see
+// SignalReload, and when they're found to have changed, which is checked at
+// most once per minute.
+func WithTLS(certFile, keyFile string) ServerOption {
+	return func(s *serverConfig) {
+		s.cert = &certReloader{certFile: certFile, keyFile: keyFile}
+	}
+}
+
+// WithH2C makes the HTTP server accept HTTP/2 without TLS in addition to
+// HTTP/1.
+func WithH2C() ServerOption {
+	return func(s *serverConfig) {
+		s.h2c = true
+	}
+}
+
+// WithShutdownTimeout sets how long the server is given to finish in-flight
+// requests or connections when it's stopped. It defaults to 10 seconds.
+func WithShutdownTimeout(d time.Duration) ServerOption {
+	return func(s *serverConfig) {
+		s.shutdownTimeout = d
+	}
+}
+
+// WithDrainDelay makes the server report itself as not ready (see NotReady)
+// and keep serving for d before shutting down, so that load balancers have
+// time to stop sending it traffic.
+func WithDrainDelay(d time.Duration) ServerOption {
+	return func(s *serverConfig) {
+		s.drainDelay = d
+	}
+}
+
+type serverConfig struct {
+	listeners       []func() (net.Listener, error)
+	packetConns     []func() (c net.PacketConn, opened bool, err error)
+	cert            *certReloader
+	h2c             bool
+	shutdownTimeout time.Duration
+	drainDelay      time.Duration
+}
+
+func newServerConfig(opts []ServerOption) serverConfig {
+	cfg := serverConfig{shutdownTimeout: 10 * time.Second}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// serving holds the logic shared by the runners returned by ListenAndServe,
+// Serve and ServePacket.
+type serving struct {
+	serverConfig
+	// drained is set once Drain has been called
+	drained atomic.Bool
+}
+
+// serve calls each of the serve functions in its own goroutine, reports the
+// runner as ready and waits for ctx to be canceled, after which the server is
+// given the drain delay and shut down. If a serve function returns first,
+// other than because Drain shut the server down as reported by closed, the
+// server is stopped right away and the error returned.
+func (s *serving) serve(ctx context.Context, serve []func() error, closed func(error) bool, stop func(), shutdown func() error) error {
+	errc := make(chan error, len(serve))
+	for _, fn := range serve {
+		go func(fn func() error) {
+			errc <- fn()
+		}(fn)
+	}
+	Ready(ctx)
+
+	select {
+	case <-ctx.Done():
+	case err := <-errc:
+		if !s.drained.Load() || !closed(err) {
+			// stop serving on the other listeners too
+			stop()
+			return err
+		}
+		// Drain shut the server down and is waiting for the requests in
+		// flight, which may go on until ctx is canceled
+		<-ctx.Done()
+	}
+
+	if s.drainDelay > 0 && !s.drained.Load() {
+		NotReady(ctx)
+		<-ClockFrom(ctx).NewTimer(s.drainDelay).C()
+	}
+	if err := shutdown(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// drain implements Drainer: with WithDrainDelay, the runner first reports
+// itself as not ready and keeps serving for the delay, and then the server is
+// shut down within ctx.
+func (s *serving) drain(ctx context.Context, shutdown func(context.Context) error) error {
+	s.drained.Store(true)
+	if s.drainDelay > 0 {
+		NotReady(ctx)
+		timer := ClockFrom(ctx).NewTimer(s.drainDelay)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+	return shutdown(ctx)
+}
+
+type httpServer struct {
+	serving
+	server *http.Server
+}
+
+// ListenAndServe provides a graceful shutdown for an http.Server.
+// usage: `w.Add(await.ListenAndServe(srv))` followed by the normal w.Run(ctx)
+//
+// Since an http.Server can't be used again once it has been shut down, the
+// runner can't be restarted: Run returns an error if it's given a restart
+// policy (see WithRestart), and it's left running when the other runners are
+// restarted with the OneForAll strategy.
+//
+// By default it listens on server.Addr like server.ListenAndServe does, which
+// can be changed with WithAddr, WithListener and WithUnixSocket. The runner
+// reports itself as ready (see Ready) once it's listening.
+//
+// The listeners it opens, but not those given with WithListener, are passed
+// on to the new process on upgrade (see SignalUpgrade), and inherited by it
+// rather than opened again.
+func ListenAndServe(server *http.Server, opts ...ServerOption) Runner {
+	return &httpServer{server: server, serving: serving{serverConfig: newServerConfig(opts)}}
+}
+
+// runOnce marks the runner as not restartable, since an http.Server can't be
+// used again once it has been shut down.
+func (s *httpServer) runOnce() {}
+
+func (s *httpServer) Run(ctx context.Context) error {
+	if s.h2c {
+		if s.server.Protocols == nil {
+			s.server.Protocols = new(http.Protocols)
+			s.server.Protocols.SetHTTP1(true)
+		}
+		s.server.Protocols.SetUnencryptedHTTP2(true)
+	}
+	if s.cert != nil {
+		if err := s.cert.load(); err != nil {
+			return err
+		}
+		cfg := &tls.Config{}
+		if s.server.TLSConfig != nil {
+			cfg = s.server.TLSConfig.Clone()
+		}
+		cfg.GetCertificate = s.cert.getCertificate
+		s.server.TLSConfig = cfg
+	}
+
+	addr := s.server.Addr
+	if addr == "" {
+		addr = ":http"
+		if s.cert != nil {
+			addr = ":https"
+		}
+	}
+	listeners, err := s.listen(addr)
+	if err != nil {
+		return err
+	}
+
+	serve := make([]func() error, len(listeners))
+	for i, l := range listeners {
+		l := l
+		serve[i] = func() error {
+			if s.cert != nil {
+				return s.server.ServeTLS(l, "", "")
+			}
+			return s.server.Serve(l)
+		}
+	}
+	closed := func(err error) bool {
+		return errors.Is(err, http.ErrServerClosed)
+	}
+	stop := func() {
+		_ = s.server.Close()
+	}
+	return s.serve(ctx, serve, closed, stop, func() error {
+		cto, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+		defer cancel()
+		return s.server.Shutdown(cto)
+	})
+}
+
+// Drain stops the server from accepting connections and waits for the
+// requests in flight to finish, see Drainer. With WithDrainDelay, the server
+// first reports itself as not ready and keeps serving for the delay.
+func (s *httpServer) Drain(ctx context.Context) error {
+	return s.drain(ctx, s.server.Shutdown)
+}
+
+// Reload reloads the TLS certificate, if any.
+func (s *httpServer) Reload(ctx context.Context) error {
+	if s.cert == nil {
+		return nil
+	}
+	return s.cert.load()
+}
+
+// listen opens all of the listeners, or listens on the TCP address addr if
+// none were given.
+func (s *serverConfig) listen(addr string) ([]net.Listener, error) {
+	open := s.listeners
+	if len(open) == 0 {
+		if addr == "" {
+			return nil, errors.New("await: no address to listen on")
+		}
+		open = append(open, func() (net.Listener, error) {
+			return listen("tcp", addr)
+		})
+	}
+
+	var listeners []net.Listener
+	for _, fn := range open {
+		l, err := fn()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// certCheckInterval is how often the certificate files are checked for
+// changes.
+const certCheckInterval = time.Minute
+
+// certReloader serves a certificate loaded from files which may change.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+func (c *certReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	modTime, err := c.modified()
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.cert = &cert
+	c.modTime = modTime
+	c.checked = time.Now()
+	c.mu.Unlock()
+	return nil
+}
+
+// modified returns the latest modification time of the files.
+func (c *certReloader) modified() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{c.certFile, c.keyFile} {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	check := time.Since(c.checked) > certCheckInterval
+	if check {
+		c.checked = time.Now()
+	}
+	cert, modTime := c.cert, c.modTime
+	c.mu.Unlock()
+
+	if check {
+		// keep serving the current certificate if the new one can't be loaded
+		if latest, err := c.modified(); err == nil && latest.After(modTime) {
+			if err := c.load(); err == nil {
+				c.mu.Lock()
+				cert = c.cert
+				c.mu.Unlock()
+			}
+		}
+	}
+	if cert == nil {
+		return nil, errors.New("await: no certificate loaded")
+	}
+	return cert, nil
+}
@@ -0,0 +1,59 @@
+package await_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/runreveal/lib/await"
+	"github.com/runreveal/lib/await/awaittest"
+)
+
+func TestListenAndServeH2C(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, r.Proto)
+		}),
+	}
+	rec := &awaittest.Recorder{}
+	w := await.New(await.WithStopTimeout(time.Second), rec.Option())
+	w.AddNamed(await.ListenAndServe(server, await.WithListener(l), await.WithH2C()), "http")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+	rec.Wait(t, await.EventReady, "http")
+
+	get := func(protocols *http.Protocols) string {
+		t.Helper()
+		client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+		defer client.CloseIdleConnections()
+		resp, err := client.Get("http://" + l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+	h2c := new(http.Protocols)
+	h2c.SetUnencryptedHTTP2(true)
+	if proto := get(h2c); proto != "HTTP/2.0" {
+		t.Fatalf("expected HTTP/2.0, got %q", proto)
+	}
+	if proto := get(nil); proto != "HTTP/1.1" {
+		t.Fatalf("expected HTTP/1.1, got %q", proto)
+	}
+
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
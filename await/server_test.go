@@ -0,0 +1,270 @@
+package await_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/runreveal/lib/await"
+	"github.com/runreveal/lib/await/awaittest"
+)
+
+func TestListenAndServeListeners(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sock := filepath.Join(t.TempDir(), "http.sock")
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "hello")
+		}),
+	}
+	ready := make(chan struct{})
+	w := await.New(await.WithStopTimeout(time.Second), await.WithHook(await.HookFunc(func(ev await.Event) {
+		if ev.Type == await.EventReady && ev.Name == "http" {
+			close(ready)
+		}
+	})))
+	w.AddNamed(await.ListenAndServe(server,
+		await.WithListener(tcp),
+		await.WithUnixSocket(sock),
+		await.WithDrainDelay(10*time.Millisecond),
+	), "http", await.WithReadiness())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+	<-ready
+
+	get := func(client *http.Client, url string) {
+		t.Helper()
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != "hello" {
+			t.Fatalf("unexpected body %q", body)
+		}
+	}
+	get(http.DefaultClient, "http://"+tcp.Addr().String())
+	get(&http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", sock)
+		},
+	}}, "http://unix")
+
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestListenAndServeDrain(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inFlight := make(chan struct{})
+	release := make(chan struct{})
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(inFlight)
+			<-release
+			_, _ = io.WriteString(w, "done")
+		}),
+	}
+	draining := make(chan struct{})
+	w := await.New(await.WithStopTimeout(time.Second), await.WithHook(await.HookFunc(func(ev await.Event) {
+		if ev.Type == await.EventDraining {
+			close(draining)
+		}
+	})))
+	w.AddNamed(await.ListenAndServe(server, await.WithListener(l)), "http")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+
+	respc := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + l.Addr().String())
+		if err != nil {
+			respc <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		respc <- string(body)
+	}()
+	<-inFlight
+
+	// the request in flight is completed while draining
+	cancel()
+	<-draining
+	close(release)
+	if body := <-respc; body != "done" {
+		t.Fatalf("expected the request to complete, got %q", body)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestListenAndServeRestart(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "hello")
+		}),
+	}
+
+	// a restart policy is refused
+	w := await.New()
+	w.AddNamed(await.ListenAndServe(server, await.WithListener(l)), "http", await.WithRestart(await.Transient))
+	if err := w.Run(context.Background()); err == nil {
+		t.Fatal("expected an error with a restart policy")
+	}
+
+	// it's left running when its peers are restarted
+	rec := &awaittest.Recorder{}
+	w = await.New(
+		await.WithStopTimeout(time.Second),
+		await.WithStrategy(await.OneForAll),
+		await.WithBackoff(time.Millisecond, time.Millisecond),
+		rec.Option(),
+	)
+	w.AddNamed(await.ListenAndServe(server, await.WithListener(l)), "http")
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		if await.Attempt(ctx) == 1 {
+			return errors.New("boom")
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}), "flaky", await.WithRestart(await.Transient))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+	rec.WaitN(t, 2, await.EventStarted, "flaky")
+
+	resp, err := http.Get("http://" + l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := len(rec.Names(await.EventStarted)); n != 3 {
+		t.Fatalf("expected http to be started once, got %q", rec.Names(await.EventStarted))
+	}
+}
+
+// writeCert writes a self-signed certificate for the given common name and
+// its key to cert.pem and key.pem in dir.
+func writeCert(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestListenAndServeTLS(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "first")
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "hello")
+		}),
+	}
+	rec := &awaittest.Recorder{}
+	w := await.New(await.WithStopTimeout(time.Second), rec.Option())
+	w.AddNamed(await.ListenAndServe(server, await.WithListener(l), await.WithTLS(certFile, keyFile)), "https")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+	rec.Wait(t, await.EventReady, "https")
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		DisableKeepAlives: true,
+	}}
+	served := func() string {
+		t.Helper()
+		resp, err := client.Get("https://" + l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		return resp.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	if name := served(); name != "first" {
+		t.Fatalf("expected the first certificate, got %q", name)
+	}
+
+	// the new certificate is served once reloaded
+	writeCert(t, dir, "second")
+	if err := w.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if name := served(); name != "second" {
+		t.Fatalf("expected the second certificate, got %q", name)
+	}
+
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
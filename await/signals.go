@@ -0,0 +1,136 @@
+package await
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime/pprof"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// SignalAction is what the runner does when it receives a signal.
+type SignalAction int
+
+const (
+	// SignalStop begins shutdown. Receiving a stop signal again while shutting
+	// down makes Run return immediately instead of waiting for the stop
+	// timeout.
+	SignalStop SignalAction = iota + 1
+	// SignalReload calls Reload on every running runner which implements
+	// Reloader.
+	SignalReload
+	// SignalDump writes the state of every runner and the stacks of all
+	// goroutines to the dump writer, see WithDumpWriter.
+	SignalDump
+	// SignalUpgrade starts a new instance of the executable with the same
+	// arguments and environment, passing it the listeners opened by
+	// ListenAndServe. Once the new process is ready, shutdown begins as with
+	// SignalStop while the new process keeps serving the listeners. If the
+	// new process fails to become ready, see WithUpgradeTimeout, it's killed
+	// and this one keeps running.
+	SignalUpgrade
+)
+
+// WithSignals makes the runner stop on SIGINT and SIGTERM.
+func WithSignals(r *runner) {
+	WithSignal(syscall.SIGINT, SignalStop)(r)
+	WithSignal(syscall.SIGTERM, SignalStop)(r)
+}
+
+// WithSignal makes the runner take the given action when it receives sig.
+func WithSignal(sig os.Signal, action SignalAction) Option {
+	return func(r *runner) {
+		if r.signals == nil {
+			r.signals = make(map[os.Signal]SignalAction)
+		}
+		r.signals[sig] = action
+	}
+}
+
+// WithSignalChannel makes the runner receive signals from c instead of from
+// the process, so that tests can inject them. They're handled as set with
+// WithSignals and WithSignal, and signals without an action stop the runner.
+func WithSignalChannel(c <-chan os.Signal) Option {
+	return func(r *runner) {
+		r.sigSource = c
+	}
+}
+
+// WithDumpWriter sets where SignalDump writes to. It defaults to os.Stderr.
+func WithDumpWriter(w io.Writer) Option {
+	return func(r *runner) {
+		r.dumpWriter = w
+	}
+}
+
+// Reloader is implemented by runners which can reload their configuration
+// without being restarted.
+type Reloader interface {
+	Reload(context.Context) error
+}
+
+// Reload calls Reload on every running runner which implements Reloader, in
+// dependency order, and returns the errors they return joined together. It's
+// called when a SignalReload signal is received and lets groups be nested.
+func (r *runner) Reload(ctx context.Context) error {
+	if !r.reloadMu.TryLock() {
+		return errors.New("await: reload already in progress")
+	}
+	defer r.reloadMu.Unlock()
+
+	type target struct {
+		e   *entry
+		ctx context.Context
+	}
+	var targets []target
+	r.mu.Lock()
+	for _, e := range r.entries {
+		if _, ok := e.run.(Reloader); ok && e.running {
+			targets = append(targets, target{e: e, ctx: e.ctx})
+		}
+	}
+	r.mu.Unlock()
+	sort.SliceStable(targets, func(i, j int) bool {
+		return targets[i].e.phase < targets[j].e.phase
+	})
+
+	var errs []error
+	for _, t := range targets {
+		if err := ctx.Err(); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		if err := t.e.run.(Reloader).Reload(t.ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", t.e, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// dump writes the state of every runner followed by a goroutine profile in
+// which the goroutines of each runner are labeled with its name.
+func (r *runner) dump() {
+	w := r.dumpWriter
+	if w == nil {
+		w = os.Stderr
+	}
+	statuses := r.Status()
+	fmt.Fprintf(w, "await: %d runners\n", len(statuses))
+	for _, s := range statuses {
+		var since string
+		if !s.StartedAt.IsZero() {
+			since = r.clock.Now().Sub(s.StartedAt).Round(time.Millisecond).String()
+		}
+		fmt.Fprintf(w, "%s\tstate=%s restarts=%d since=%s", s.Name, s.State, s.Restarts, since)
+		if s.LastError != nil {
+			fmt.Fprintf(w, " last_error=%q", s.LastError)
+		}
+		fmt.Fprintln(w)
+	}
+	if err := pprof.Lookup("goroutine").WriteTo(w, 1); err != nil {
+		r.log().Error("await: writing goroutine profile", "err", err)
+	}
+}
@@ -0,0 +1,153 @@
+package await
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// State is the state of a runner.
+type State int
+
+const (
+	// StatePending runners haven't been started yet.
+	StatePending State = iota
+	// StateStarting runners have been started but haven't reported being
+	// ready yet, see WithReadiness.
+	StateStarting
+	// StateReady runners have reported being ready.
+	StateReady
+	// StateRunning runners are running but don't report readiness, or have
+	// reported not being ready anymore.
+	StateRunning
+	// StateStopping runners have been canceled but haven't returned yet.
+	StateStopping
+	// StateExited runners have returned and won't be restarted.
+	StateExited
+	// StateRestarting runners have returned and are waiting to be restarted.
+	StateRestarting
+)
+
+func (s State) String() string {
+	switch s {
+	case StatePending:
+		return "pending"
+	case StateStarting:
+		return "starting"
+	case StateReady:
+		return "ready"
+	case StateRunning:
+		return "running"
+	case StateStopping:
+		return "stopping"
+	case StateExited:
+		return "exited"
+	case StateRestarting:
+		return "restarting"
+	}
+	return "unknown"
+}
+
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// RunnerStatus is a snapshot of the status of a runner.
+type RunnerStatus struct {
+	Name  string `json:"name"`
+	State State  `json:"state"`
+	// StartedAt is when the runner was last started.
+	StartedAt time.Time `json:"started_at"`
+	// Restarts is how many times the runner has been restarted.
+	Restarts int `json:"restarts"`
+	// LastError is the last error the runner returned, other than
+	// context.Canceled.
+	LastError error `json:"-"`
+	// Breaker is the state of the runner's circuit breaker, see
+	// WithCircuitBreaker.
+	Breaker BreakerState `json:"breaker"`
+}
+
+func (s RunnerStatus) MarshalJSON() ([]byte, error) {
+	type status RunnerStatus
+	var lastError string
+	if s.LastError != nil {
+		lastError = s.LastError.Error()
+	}
+	return json.Marshal(struct {
+		status
+		LastError string `json:"last_error,omitempty"`
+	}{status(s), lastError})
+}
+
+// Status returns a snapshot of the status of every runner. The runners of
+// subgroups follow the subgroup.
+func (r *runner) Status() []RunnerStatus {
+	r.mu.Lock()
+	children := r.children()
+	var subgroups []*runner
+	statuses := make([]RunnerStatus, 0, len(r.entries))
+	now := r.clock.Now()
+	for _, e := range r.entries {
+		var breaker BreakerState
+		if r.breaker != nil {
+			breaker = r.breakerState(e, now)
+		}
+		statuses = append(statuses, RunnerStatus{
+			Name:      e.String(),
+			State:     r.state(e),
+			StartedAt: e.startedAt,
+			Restarts:  max(e.attempts-1, 0),
+			LastError: e.lastErr,
+			Breaker:   breaker,
+		})
+		subgroups = append(subgroups, children[e])
+	}
+	r.mu.Unlock()
+
+	if len(children) == 0 {
+		return statuses
+	}
+	all := make([]RunnerStatus, 0, len(statuses))
+	for i, s := range statuses {
+		all = append(all, s)
+		if g := subgroups[i]; g != nil {
+			all = append(all, g.Status()...)
+		}
+	}
+	return all
+}
+
+// state returns the state of the entry. r.mu must be held.
+func (r *runner) state(e *entry) State {
+	switch {
+	case e.startedAt.IsZero():
+		return StatePending
+	case e.running && (r.stopping || e.removed || e.canceled):
+		return StateStopping
+	case e.running && e.isReady:
+		if e.waitReady {
+			return StateReady
+		}
+		return StateRunning
+	case e.running:
+		select {
+		case <-e.notifier.ready:
+			return StateRunning
+		default:
+			return StateStarting
+		}
+	case e.finished || e.removed || r.stopping:
+		return StateExited
+	}
+	return StateRestarting
+}
+
+// StatusHandler returns an http.Handler which serves the result of Status as
+// JSON.
+func (r *runner) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(r.Status())
+	})
+}
@@ -0,0 +1,161 @@
+package await
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// RestartPolicy determines whether a runner is restarted in place when it
+// returns. A runner which isn't restarted is handled as usual: a non-nil error
+// stops the whole group, as does a nil error unless WithContinueOnNil is set.
+type RestartPolicy int
+
+const (
+	// Temporary runners are never restarted. This is the default.
+	Temporary RestartPolicy = iota
+	// Transient runners are restarted only if they return a non-nil error
+	// other than context.Canceled.
+	Transient
+	// Permanent runners are always restarted, even if they return nil.
+	Permanent
+)
+
+// WithRestart sets the restart policy of the runner. Runners which can only be
+// run once, like those returned by ListenAndServe, can't have a policy other
+// than Temporary.
+func WithRestart(p RestartPolicy) RunnerOption {
+	return func(e *entry) {
+		e.policy = p
+	}
+}
+
+// Strategy determines which runners are restarted when a runner is restarted.
+type Strategy int
+
+const (
+	// OneForOne only restarts the runner which returned. This is the default.
+	OneForOne Strategy = iota
+	// OneForAll stops all other runners and then restarts all of them, in
+	// dependency order, along with the one which returned. Unlike Erlang's
+	// one_for_all, which terminates its temporary children without restarting
+	// them, Temporary runners are left running, and so are runners which can
+	// only be run once, like those returned by ListenAndServe. A Temporary
+	// runner which isn't running at that point isn't started again.
+	OneForAll
+)
+
+// WithStrategy sets the restart strategy of the runner.
+func WithStrategy(s Strategy) Option {
+	return func(r *runner) {
+		r.strategy = s
+	}
+}
+
+// Backoff configures the delay before a runner is restarted. The delay starts
+// at Min and doubles on each consecutive restart of the same runner up to Max.
+// The actual delay is chosen at random between half the computed delay and
+// the full delay. A runner which ran for longer than Max before returning is
+// restarted after Min again.
+type Backoff struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+// delay returns the jittered delay for the nth consecutive restart, starting
+// at 0.
+func (b Backoff) delay(n int) time.Duration {
+	d := b.Min
+	for i := 0; i < n && d < b.Max; i++ {
+		d *= 2
+	}
+	d = min(d, b.Max)
+	if d <= 1 {
+		return d
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)))
+}
+
+// WithBackoff sets the minimum and maximum delay between restarts. It defaults
+// to 100ms and 10s.
+func WithBackoff(min, max time.Duration) Option {
+	return func(r *runner) {
+		r.backoff = Backoff{Min: min, Max: max}
+	}
+}
+
+// WithRestartIntensity limits the runner to n restarts within the given
+// window. If more restarts are needed the runner escalates by shutting down
+// all of its subroutines and returning an error wrapping ErrTooManyRestarts.
+// It defaults to 3 restarts in 5 seconds.
+func WithRestartIntensity(n int, window time.Duration) Option {
+	return func(r *runner) {
+		r.maxRestarts = n
+		r.restartWindow = window
+	}
+}
+
+// ErrTooManyRestarts is returned by Run when the restart intensity is exceeded.
+var ErrTooManyRestarts = errors.New("await: too many restarts")
+
+// errRestarting is the cause given to runners which are stopped so that they
+// can be restarted with the OneForAll strategy.
+var errRestarting = errors.New("await: restarting")
+
+// runOnce is implemented by runners which can only be run once, and which
+// therefore can't be restarted.
+type runOnce interface {
+	runOnce()
+}
+
+// restartable reports whether the entry's runner can be run again.
+func (e *entry) restartable() bool {
+	_, once := e.run.(runOnce)
+	return !once
+}
+
+// checkRestart returns an error if the entry has a restart policy but can't
+// be restarted.
+func (e *entry) checkRestart() error {
+	if e.policy != Temporary && !e.restartable() {
+		return fmt.Errorf("await: %q can't be restarted", e)
+	}
+	return nil
+}
+
+// shouldRestart reports whether the entry should be restarted after having
+// returned err.
+func (e *entry) shouldRestart(err error) bool {
+	switch e.policy {
+	case Permanent:
+		return true
+	case Transient:
+		return isFailure(err)
+	}
+	return false
+}
+
+// allowRestart records a restart at the given time and reports whether it is
+// within the restart intensity.
+func (r *runner) allowRestart(now time.Time) bool {
+	keep := r.restarts[:0]
+	for _, t := range r.restarts {
+		if now.Sub(t) < r.restartWindow {
+			keep = append(keep, t)
+		}
+	}
+	r.restarts = append(keep, now)
+	return len(r.restarts) <= r.maxRestarts
+}
+
+// restartDelay returns how long to wait before restarting the entry.
+func (r *runner) restartDelay(e *entry, now time.Time) time.Duration {
+	if now.Sub(e.startedAt) > r.backoff.Max {
+		e.failures = 0
+	}
+	d := r.backoff.delay(e.failures)
+	e.failures++
+	return d
+}
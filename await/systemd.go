@@ -0,0 +1,108 @@
+package await
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// WithSystemd makes Run report its state to systemd with the sd_notify
+// protocol when NOTIFY_SOCKET is set, as it is for services with Type=notify.
+// READY=1 is sent once every runner is ready and STOPPING=1 when shutdown
+// begins. If the service has a watchdog (WatchdogSec=), WATCHDOG=1 is sent at
+// half its interval while every runner which hasn't finished is running, so
+// that systemd restarts the service if a runner is stuck waiting to be
+// restarted.
+func WithSystemd(r *runner) {
+	r.systemd = true
+}
+
+// sdNotifier sends notifications to systemd over a unix datagram socket.
+type sdNotifier struct {
+	conn *net.UnixConn
+}
+
+// newSDNotifier returns a notifier for NOTIFY_SOCKET, or nil if it isn't set.
+func newSDNotifier() (*sdNotifier, error) {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return nil, nil
+	}
+	// a leading @ denotes a socket in the abstract namespace
+	if path[0] == '@' {
+		path = "\x00" + path[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &sdNotifier{conn: conn}, nil
+}
+
+func (n *sdNotifier) notify(state string) error {
+	if n == nil {
+		return nil
+	}
+	_, err := n.conn.Write([]byte(state))
+	return err
+}
+
+func (n *sdNotifier) close() {
+	if n != nil {
+		n.conn.Close()
+	}
+}
+
+// watchdogInterval returns the interval the watchdog expects to be pinged at,
+// or zero if it isn't enabled for this process.
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// sdNotify sends a notification to systemd if WithSystemd was given.
+func (r *runner) sdNotify(state string) {
+	if err := r.sd.notify(state); err != nil {
+		r.log().Error("await: notifying systemd", "state", state, "err", err)
+	}
+}
+
+// watchdog pings the systemd watchdog until stop is closed, skipping the
+// pings while a runner is unhealthy.
+func (r *runner) watchdog(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			// runners stop one after the other while shutting down, which
+			// the stop timeout bounds already
+			r.mu.Lock()
+			ok := r.stopping || r.healthy()
+			r.mu.Unlock()
+			if ok {
+				r.sdNotify("WATCHDOG=1")
+			}
+		}
+	}
+}
+
+// healthy reports whether every runner which hasn't finished is running.
+// r.mu must be held.
+func (r *runner) healthy() bool {
+	for _, e := range r.entries {
+		if !e.finished && !e.running {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,73 @@
+//go:build unix
+
+package await_test
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/runreveal/lib/await"
+)
+
+func TestSystemd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+	t.Setenv("WATCHDOG_USEC", "20000")
+
+	states := make(chan string, 100)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				close(states)
+				return
+			}
+			states <- string(buf[:n])
+		}
+	}()
+	expect := func(state string) {
+		t.Helper()
+		timeout := time.After(time.Second)
+		for {
+			select {
+			case s, ok := <-states:
+				if !ok {
+					t.Fatalf("notify socket closed while expecting %s", state)
+				}
+				if s == state {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("expected %s", state)
+			}
+		}
+	}
+
+	w := await.New(await.WithStopTimeout(time.Second), await.WithSystemd)
+	w.AddNamed(await.RunFunc(func(ctx context.Context) error {
+		await.Ready(ctx)
+		<-ctx.Done()
+		return ctx.Err()
+	}), "db", await.WithReadiness())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+
+	expect("READY=1")
+	expect("WATCHDOG=1")
+	cancel()
+	expect("STOPPING=1")
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
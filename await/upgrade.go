@@ -0,0 +1,271 @@
+package await
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// listenersEnv holds the keys of the listeners passed to an upgraded
+	// process, in the order of their file descriptors from 3 on.
+	listenersEnv = "AWAIT_LISTENERS"
+	// upgradeReadyEnv holds the file descriptor an upgraded process writes to
+	// once it's ready.
+	upgradeReadyEnv = "AWAIT_UPGRADE_READY"
+)
+
+// WithUpgradeTimeout sets how long a process started by SignalUpgrade is
+// given to become ready before the upgrade is abandoned. It defaults to a
+// minute.
+func WithUpgradeTimeout(d time.Duration) Option {
+	return func(r *runner) {
+		r.upgradeTimeout = d
+	}
+}
+
+// upgrade starts a new instance of the executable with the same arguments,
+// passing it the listeners opened by ListenAndServe, and waits for it to be
+// ready. Once it returns nil, the listeners are served by the new process and
+// this one can be shut down.
+func (r *runner) upgrade() error {
+	if !r.upgradeMu.TryLock() {
+		return errors.New("await: upgrade already in progress")
+	}
+	defer r.upgradeMu.Unlock()
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	keys, files, err := activeListenerFiles()
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	if err != nil {
+		return err
+	}
+	rd, wr, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, listenersEnv+"=") && !strings.HasPrefix(kv, upgradeReadyEnv+"=") {
+			cmd.Env = append(cmd.Env, kv)
+		}
+	}
+	cmd.Env = append(cmd.Env,
+		listenersEnv+"="+strings.Join(keys, ","),
+		upgradeReadyEnv+"="+strconv.Itoa(3+len(files)),
+	)
+	cmd.ExtraFiles = append(files, wr)
+	err = cmd.Start()
+	wr.Close()
+	if err != nil {
+		return err
+	}
+
+	// the pipe is closed without anything written to it if the new process
+	// exits before being ready
+	readyc := make(chan error, 1)
+	go func() {
+		_, err := rd.Read(make([]byte, 1))
+		readyc <- err
+	}()
+	timeout := r.upgradeTimeout
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err = <-readyc:
+		if err != nil {
+			err = fmt.Errorf("await: upgraded process exited before being ready: %w", err)
+		}
+	case <-timer.C:
+		err = errors.New("await: timed out waiting for the upgraded process to be ready")
+	}
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return err
+	}
+
+	// the new process is now the main one as far as systemd is concerned
+	r.sdNotify("MAINPID=" + strconv.Itoa(cmd.Process.Pid))
+	keepUnixSockets()
+	return cmd.Process.Release()
+}
+
+// listeners tracks the listeners opened by ListenAndServe so that they can be
+// passed on by upgrade, and those passed on to this process by its parent.
+var listeners struct {
+	sync.Mutex
+	loaded    bool
+	inherited map[string]net.Listener
+	active    map[string]*trackedListener
+	ready     *os.File
+}
+
+func listenerKey(network, addr string) string {
+	return network + ":" + addr
+}
+
+// loadInherited picks up the listeners passed by the parent process, if any.
+// listeners must be locked.
+func loadInherited() {
+	if listeners.loaded {
+		return
+	}
+	listeners.loaded = true
+	listeners.inherited = make(map[string]net.Listener)
+	listeners.active = make(map[string]*trackedListener)
+
+	if fd, err := strconv.Atoi(os.Getenv(upgradeReadyEnv)); err == nil {
+		listeners.ready = os.NewFile(uintptr(fd), "upgrade-ready")
+	}
+	keys := os.Getenv(listenersEnv)
+	os.Unsetenv(listenersEnv)
+	os.Unsetenv(upgradeReadyEnv)
+	if keys == "" {
+		return
+	}
+	for i, key := range strings.Split(keys, ",") {
+		f := os.NewFile(uintptr(3+i), key)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			slog.Default().Error("await: inheriting listener", "listener", key, "err", err)
+			continue
+		}
+		listeners.inherited[key] = l
+	}
+}
+
+// inherit returns the listener for network and addr passed by the parent
+// process, or nil if there is none.
+func inherit(network, addr string) net.Listener {
+	listeners.Lock()
+	defer listeners.Unlock()
+	loadInherited()
+	key := listenerKey(network, addr)
+	l, ok := listeners.inherited[key]
+	if !ok {
+		return nil
+	}
+	delete(listeners.inherited, key)
+	return track(key, l)
+}
+
+// listen is like net.Listen, but the listener is inherited from the parent
+// process if it passed one for network and addr, and is passed on to the new
+// process on upgrade.
+func listen(network, addr string) (net.Listener, error) {
+	if l := inherit(network, addr); l != nil {
+		return l, nil
+	}
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	listeners.Lock()
+	defer listeners.Unlock()
+	return track(listenerKey(network, addr), l), nil
+}
+
+// track registers l as active. listeners must be locked.
+func track(key string, l net.Listener) net.Listener {
+	tl := &trackedListener{Listener: l, key: key}
+	listeners.active[key] = tl
+	return tl
+}
+
+// trackedListener unregisters itself when closed.
+type trackedListener struct {
+	net.Listener
+	key string
+}
+
+func (l *trackedListener) Close() error {
+	listeners.Lock()
+	if listeners.active[l.key] == l {
+		delete(listeners.active, l.key)
+	}
+	listeners.Unlock()
+	return l.Listener.Close()
+}
+
+// activeListenerFiles returns duplicates of the file descriptors of the active
+// listeners along with their keys.
+func activeListenerFiles() ([]string, []*os.File, error) {
+	listeners.Lock()
+	defer listeners.Unlock()
+	loadInherited()
+	var keys []string
+	for key := range listeners.active {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var files []*os.File
+	for _, key := range keys {
+		l, ok := listeners.active[key].Listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			return keys, files, fmt.Errorf("await: listener %s can't be passed on", key)
+		}
+		f, err := l.File()
+		if err != nil {
+			return keys, files, fmt.Errorf("await: listener %s: %w", key, err)
+		}
+		files = append(files, f)
+	}
+	return keys, files, nil
+}
+
+// keepUnixSockets stops the unix sockets from being removed when their
+// listeners are closed, since they're now served by the new process.
+func keepUnixSockets() {
+	listeners.Lock()
+	defer listeners.Unlock()
+	for _, l := range listeners.active {
+		if ul, ok := l.Listener.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+}
+
+// upgraded tells the parent process, if this process was started by an
+// upgrade, that it's ready, and closes the inherited listeners which weren't
+// used.
+func upgraded() {
+	listeners.Lock()
+	defer listeners.Unlock()
+	loadInherited()
+	if listeners.ready == nil {
+		return
+	}
+	if _, err := listeners.ready.Write([]byte{1}); err != nil {
+		slog.Default().Error("await: notifying parent process", "err", err)
+	}
+	listeners.ready.Close()
+	listeners.ready = nil
+	for key, l := range listeners.inherited {
+		l.Close()
+		delete(listeners.inherited, key)
+	}
+}
@@ -0,0 +1,111 @@
+//go:build unix
+
+package await_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/runreveal/lib/await"
+)
+
+const upgradeAddrEnv = "AWAIT_TEST_UPGRADE_ADDR"
+
+func TestMain(m *testing.M) {
+	// the test binary is executed again by TestUpgrade, in which case it acts
+	// as the upgraded process instead of running the tests
+	if addr := os.Getenv(upgradeAddrEnv); addr != "" && os.Getenv("AWAIT_LISTENERS") != "" {
+		upgradedProcess(addr)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func upgradedProcess(addr string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "child")
+	})
+	mux.HandleFunc("/quit", func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+	})
+	w := await.New(await.WithStopTimeout(time.Second))
+	w.AddNamed(await.ListenAndServe(&http.Server{Handler: mux}, await.WithAddr("tcp", addr)), "http", await.WithReadiness())
+	_ = w.Run(ctx)
+}
+
+func TestUpgrade(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	t.Setenv(upgradeAddrEnv, addr)
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	get := func(path string) string {
+		t.Helper()
+		resp, err := client.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "parent")
+	})}
+	w := await.New(
+		await.WithStopTimeout(time.Second),
+		await.WithSignal(syscall.SIGUSR2, await.SignalUpgrade),
+		await.WithUpgradeTimeout(5*time.Second),
+	)
+	w.AddNamed(await.ListenAndServe(srv, await.WithAddr("tcp", addr)), "http", await.WithReadiness())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(context.Background()) }()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if resp, err := client.Get("http://" + addr); err == nil {
+			resp.Body.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("server didn't start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if body := get("/"); body != "parent" {
+		t.Fatalf("expected parent, got %s", body)
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected Run to return after the upgrade")
+	}
+
+	// the listener is still open, served by the new process
+	if body := get("/"); body != "child" {
+		t.Fatalf("expected child, got %s", body)
+	}
+	get("/quit")
+}